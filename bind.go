@@ -0,0 +1,99 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// BindParams stores the wildcard values in the fields of the struct pointed
+// to by dst. A field is bound to the wildcard named by its "httprouter" tag,
+// and the value is converted to the type of the field, e.g.:
+//
+//	var params struct {
+//		ID   int    `httprouter:"id,required"`
+//		Lang string `httprouter:"lang"`
+//	}
+//	err := httprouter.BindParams(vars, &params)
+//
+// Fields of the kinds string, bool, int, uint and float, and fields
+// implementing encoding.TextUnmarshaler are supported. Fields without a tag
+// or with the tag "-" are ignored, as are fields for wildcards without a
+// value, unless the tag has the option "required".
+// An error is returned if a value can't be converted or a required value is
+// missing.
+func BindParams(vars map[string]string, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("httprouter: BindParams requires a non-nil pointer to a struct")
+	}
+	v = v.Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("httprouter")
+		if !ok || tag == "-" || !field.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		value, ok := vars[name]
+		if !ok || value == "" {
+			if opts == "required" {
+				return fmt.Errorf("httprouter: missing required param %q", name)
+			}
+			continue
+		}
+
+		if err := setField(v.Field(i), value); err != nil {
+			return fmt.Errorf("httprouter: can't bind param %q to field %s: %w", name, field.Name, err)
+		}
+	}
+	return nil
+}
+
+// setField sets the field to the value converted to the type of the field.
+func setField(field reflect.Value, value string) error {
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestBindParams(t *testing.T) {
+	type params struct {
+		ID       int64      `httprouter:"id,required"`
+		Name     string     `httprouter:"name"`
+		Page     uint8      `httprouter:"page"`
+		Draft    bool       `httprouter:"draft"`
+		Score    float64    `httprouter:"score"`
+		Addr     netip.Addr `httprouter:"addr"`
+		Ignored  string     `httprouter:"-"`
+		Untagged string
+	}
+
+	var got params
+	err := BindParams(map[string]string{
+		"id":       "42",
+		"name":     "gopher",
+		"page":     "3",
+		"draft":    "true",
+		"score":    "1.5",
+		"addr":     "127.0.0.1",
+		"Ignored":  "x",
+		"Untagged": "x",
+	}, &got)
+	want := params{
+		ID:    42,
+		Name:  "gopher",
+		Page:  3,
+		Draft: true,
+		Score: 1.5,
+		Addr:  netip.MustParseAddr("127.0.0.1"),
+	}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong binding: want %+v, got %+v (err=%v)", want, got, err)
+	}
+
+	// Optional params may be missing.
+	got = params{Name: "keep"}
+	if err := BindParams(map[string]string{"id": "1"}, &got); err != nil || got.ID != 1 || got.Name != "keep" {
+		t.Errorf("wrong binding with missing optional params: %+v (err=%v)", got, err)
+	}
+
+	errors := []struct {
+		vars map[string]string
+		dst  interface{}
+	}{
+		{map[string]string{"name": "gopher"}, &params{}},
+		{map[string]string{"id": ""}, &params{}},
+		{map[string]string{"id": "x"}, &params{}},
+		{map[string]string{"id": "1", "page": "256"}, &params{}},
+		{map[string]string{"id": "1", "draft": "maybe"}, &params{}},
+		{map[string]string{"id": "1", "score": "high"}, &params{}},
+		{map[string]string{"id": "1", "addr": "localhost"}, &params{}},
+		{map[string]string{"tags": "a"}, &struct {
+			Tags []string `httprouter:"tags"`
+		}{}},
+		{nil, params{}},
+		{nil, (*params)(nil)},
+		{nil, new(int)},
+	}
+	for _, test := range errors {
+		if err := BindParams(test.vars, test.dst); err == nil {
+			t.Errorf("no error binding %v to %T", test.vars, test.dst)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync/atomic"
+)
+
+// RouteSpec describes a route registered with BuildFrom.
+type RouteSpec struct {
+	Method string
+	Path   string
+	Handle Handle
+}
+
+// BuildFrom registers many routes at once like Handle, which is faster than
+// registering them one by one: the children of the nodes are kept sorted by
+// their index while the routes are inserted and only ordered by their
+// priority once all routes are inserted, and the routes and nodes are
+// allocated in blocks. The tree is the same as if the routes were registered
+// one by one sorted by their path, thus it matches the same requests as if
+// the routes were registered in any order.
+//
+// Instead of panicking, an error is returned for the first route which can't
+// be registered, e.g. because it conflicts with another route. In that case
+// none of the routes are registered, the routes registered before are kept
+// as they were.
+func (r *Router) BuildFrom(routes []RouteSpec) error {
+	saved := r.saveRoutes()
+
+	r.bulk = true
+	r.routeSlab = make([]Route, len(routes))
+	defer func() {
+		r.bulk = false
+		r.routeSlab, r.nodeSlab = nil, nil
+	}()
+
+	for i := range routes {
+		if err := r.tryHandle(&routes[i]); err != nil {
+			saved.restore(r)
+			return err
+		}
+	}
+	if !r.StablePriorities {
+		r.node.sortChildren()
+	}
+	return nil
+}
+
+// savedRoutes are the routes of a router before a BuildFrom, which are
+// restored if it fails.
+type savedRoutes struct {
+	node    node
+	alts    map[*Route]*Route
+	routes  int
+	methods []string
+	lazy    *lazyRoutes
+	pending map[string][]pendingRoute
+	count   int64
+}
+
+// saveRoutes returns the routes registered with the router. The routes
+// themselves aren't copied, but their next candidates, which is all that
+// registering further routes modifies.
+func (r *Router) saveRoutes() *savedRoutes {
+	s := &savedRoutes{
+		alts:    make(map[*Route]*Route),
+		routes:  r.routes,
+		methods: slices.Clone(r.methods),
+		lazy:    r.lazy,
+	}
+	s.node = r.node.cloneNodes(s.alts)
+	if r.lazy != nil {
+		s.pending = make(map[string][]pendingRoute, len(r.lazy.pending))
+		for seg, routes := range r.lazy.pending {
+			s.pending[seg] = slices.Clip(routes)
+		}
+		s.count = atomic.LoadInt64(&r.lazy.count)
+	}
+	return s
+}
+
+// restore resets the routes of the router to the saved ones.
+func (s *savedRoutes) restore(r *Router) {
+	r.node = s.node
+	for route, alt := range s.alts {
+		route.alt = alt
+	}
+	r.routes, r.methods = s.routes, s.methods
+	r.lazy = s.lazy
+	if r.lazy != nil {
+		r.lazy.pending = s.pending
+		atomic.StoreInt64(&r.lazy.count, s.count)
+	}
+}
+
+// cloneNodes returns a copy of the node and its children, which share the
+// routes with them. The next candidates of the routes are recorded in alts.
+func (n *node) cloneNodes(alts map[*Route]*Route) node {
+	c := *n
+	c.indices = slices.Clone(n.indices)
+	if n.children != nil {
+		c.children = make([]*node, len(n.children))
+		for i, child := range n.children {
+			cc := child.cloneNodes(alts)
+			c.children[i] = &cc
+		}
+	}
+	if n.catchAllChild != nil {
+		cc := n.catchAllChild.cloneNodes(alts)
+		c.catchAllChild = &cc
+	}
+
+	saveAlts := func(route *Route) {
+		for ; route != nil; route = route.alt {
+			alts[route] = route.alt
+		}
+	}
+	saveAlts(n.handle.route)
+	if n.handle.routes != nil {
+		c.handle.routes = make(map[string]*Route, len(n.handle.routes))
+		for method, route := range n.handle.routes {
+			c.handle.routes[method] = route
+			saveAlts(route)
+		}
+	}
+	return c
+}
+
+// tryHandle registers the route and converts a panic into an error.
+func (r *Router) tryHandle(spec *RouteSpec) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("can't register %s %s: %v", spec.Method, spec.Path, p)
+		}
+	}()
+	r.Handle(spec.Method, spec.Path, spec.Handle)
+	return nil
+}
+
+// nodeSlabSize is the number of nodes allocated at once by BuildFrom.
+const nodeSlabSize = 256
+
+// newRoute returns the memory for a new route, which is preallocated while
+// routes are registered by BuildFrom.
+func (r *Router) newRoute() *Route {
+	if len(r.routeSlab) == 0 {
+		return new(Route)
+	}
+	route := &r.routeSlab[0]
+	r.routeSlab = r.routeSlab[1:]
+	return route
+}
+
+// newNode returns a new node for the route. While routes are registered by
+// BuildFrom, nodes are allocated in slabs.
+func newNode(route *Route) *node {
+	if route == nil || route.router == nil || !route.router.bulk {
+		return new(node)
+	}
+	r := route.router
+	if len(r.nodeSlab) == 0 {
+		r.nodeSlab = make([]node, nodeSlabSize)
+	}
+	n := &r.nodeSlab[0]
+	r.nodeSlab = r.nodeSlab[1:]
+	return n
+}
+
+// sortChildren orders the children of the node and its descendants by their
+// priority, keeping the order of children with the same priority.
+func (n *node) sortChildren() {
+	if len(n.indices) > 1 {
+		sort.Stable(byPriority{n})
+	}
+	for _, child := range n.children {
+		child.sortChildren()
+	}
+	if n.catchAllChild != nil {
+		n.catchAllChild.sortChildren()
+	}
+}
+
+// byPriority sorts the children of a node by their priority, highest first.
+type byPriority struct {
+	n *node
+}
+
+func (s byPriority) Len() int { return len(s.n.children) }
+
+func (s byPriority) Less(i, j int) bool {
+	return s.n.children[i].priority > s.n.children[j].priority
+}
+
+func (s byPriority) Swap(i, j int) {
+	s.n.children[i], s.n.children[j] = s.n.children[j], s.n.children[i]
+	s.n.indices[i], s.n.indices[j] = s.n.indices[j], s.n.indices[i]
+}
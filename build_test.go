@@ -0,0 +1,181 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"math/rand"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// manyRouteSpecs returns n routes with shared prefixes in random order.
+func manyRouteSpecs(n int) []RouteSpec {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+	var specs []RouteSpec
+	for i := 0; len(specs) < n; i++ {
+		prefix := "/api/v" + strconv.Itoa(i%7) + "/svc" + strconv.Itoa(i)
+		specs = append(specs,
+			RouteSpec{"GET", prefix + "/items", handle},
+			RouteSpec{"POST", prefix + "/items", handle},
+			RouteSpec{"GET", prefix + "/items/:id", handle},
+			RouteSpec{"PUT", prefix + "/items/:id", handle},
+			RouteSpec{"GET", prefix + "/items/:id/history", handle},
+		)
+	}
+	specs = specs[:n]
+	rnd := rand.New(rand.NewSource(1))
+	rnd.Shuffle(len(specs), func(i, j int) { specs[i], specs[j] = specs[j], specs[i] })
+	return specs
+}
+
+func TestRouterBuildFrom(t *testing.T) {
+	specs := manyRouteSpecs(500)
+	specs = append(specs,
+		RouteSpec{"GET", "/", nil},
+		RouteSpec{"GET", "/static/*filepath", nil},
+		RouteSpec{"GET", "/a", nil},
+		RouteSpec{"GET", "/ab", nil},
+	)
+
+	bulk := New()
+	if err := bulk.BuildFrom(specs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sorted := append([]RouteSpec(nil), specs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Path != sorted[j].Path {
+			return sorted[i].Path < sorted[j].Path
+		}
+		return sorted[i].Method < sorted[j].Method
+	})
+	incremental := New()
+	for _, spec := range sorted {
+		incremental.Handle(spec.Method, spec.Path, spec.Handle)
+	}
+
+	if got, want := bulk.DumpTree(), incremental.DumpTree(); got != want {
+		t.Errorf("tree differs from incremental insertion:\n%s\nwant:\n%s", got, want)
+	}
+	checkPriorities(t, &bulk.node)
+
+	// Registering the routes one by one in their original order matches the
+	// requests the same way.
+	unsorted := New()
+	for _, spec := range specs {
+		unsorted.Handle(spec.Method, spec.Path, spec.Handle)
+	}
+	paths := []string{"/nope", "/ab/", "/static", "/api/v1/svc1", "/api/v1/svc1/items/"}
+	for _, spec := range specs {
+		path := strings.Replace(spec.Path, ":id", "42", 1)
+		paths = append(paths, strings.Replace(path, "*filepath", "x/y", 1))
+	}
+	for _, method := range []string{"GET", "POST", "PUT"} {
+		for _, path := range paths {
+			got, gotVars, gotTSR := bulk.getValue(method, path)
+			want, wantVars, wantTSR := unsorted.getValue(method, path)
+			if (got == nil) != (want == nil) || got != nil && got.Path != want.Path ||
+				!reflect.DeepEqual(gotVars, wantVars) || gotTSR != wantTSR {
+				t.Errorf("%s %s: got %v %v %t, want %v %v %t like unsorted registration",
+					method, path, got, gotVars, gotTSR, want, wantVars, wantTSR)
+			}
+		}
+	}
+
+	if n := bulk.NumRoutes(); n != len(specs) {
+		t.Errorf("wrong number of routes: want %d, got %d", len(specs), n)
+	}
+	if route, vars, _ := bulk.getValue("PUT", "/api/v3/svc10/items/42"); route == nil || vars["id"] != "42" {
+		t.Errorf("route not matched: %v %v", route, vars)
+	}
+
+	// Routes can be added later on, reordering the children again.
+	bulk.GET("/zz/1", nil)
+	bulk.GET("/zz/2", nil)
+	checkPriorities(t, &bulk.node)
+}
+
+func TestRouterBuildFromConflict(t *testing.T) {
+	router := New()
+	err := router.BuildFrom([]RouteSpec{
+		{"GET", "/users/:id", nil},
+		{"GET", "/users/:name/posts", nil},
+		{"GET", "/about", nil},
+	})
+	if err == nil {
+		t.Fatal("no error for conflicting routes")
+	}
+	if msg := err.Error(); !strings.Contains(msg, "GET /users/:name/posts") || !strings.Contains(msg, "/users/:id") {
+		t.Errorf("error %q doesn't name the conflicting routes", msg)
+	}
+	if route, _, _ := router.getValue("GET", "/about"); route != nil {
+		t.Error("route registered despite the conflict")
+	}
+	if n := router.NumRoutes(); n != 0 {
+		t.Errorf("wrong number of routes: want 0, got %d", n)
+	}
+
+	// The routes registered before are kept as they were.
+	router = New()
+	before := router.GET("/users/:id", nil).When(func(*http.Request) bool { return true })
+	router.POST("/users", nil)
+	tree := router.DumpTree()
+	err = router.BuildFrom([]RouteSpec{
+		{"GET", "/users/:id", nil},
+		{"DELETE", "/users/:id", nil},
+		{"GET", "/users/:name/posts", nil},
+	})
+	if err == nil {
+		t.Fatal("no error for route conflicting with a registered route")
+	}
+	if got := router.DumpTree(); got != tree {
+		t.Errorf("tree modified by the failed build:\n%s\nwant:\n%s", got, tree)
+	}
+	if before.alt != nil {
+		t.Error("candidate of the failed build kept")
+	}
+	if n := router.NumRoutes(); n != 2 {
+		t.Errorf("wrong number of routes: want 2, got %d", n)
+	}
+	if !reflect.DeepEqual(router.methods, []string{"GET", "POST"}) {
+		t.Errorf("wrong methods: %v", router.methods)
+	}
+	if err := router.BuildFrom([]RouteSpec{{"DELETE", "/users/:id", nil}}); err != nil {
+		t.Errorf("unexpected error after the failed build: %v", err)
+	}
+
+	if err := New().BuildFrom([]RouteSpec{{"GET", "/a", nil}, {"GET", "/a", nil}}); err == nil {
+		t.Error("no error for duplicate routes")
+	}
+	if err := New().BuildFrom([]RouteSpec{{"GET", "noslash", nil}}); err == nil {
+		t.Error("no error for invalid path")
+	}
+}
+
+func BenchmarkRouterBuildIncremental(b *testing.B) {
+	specs := manyRouteSpecs(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router := New()
+		for _, spec := range specs {
+			router.Handle(spec.Method, spec.Path, spec.Handle)
+		}
+	}
+}
+
+func BenchmarkRouterBuildFrom(b *testing.B) {
+	specs := manyRouteSpecs(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := New().BuildFrom(specs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import "net/http"
+
+// Chain is a http.Handler which dispatches requests to the first of its
+// routers handling them, e.g. to serve routers built by different modules
+// with one http.Server:
+//
+//	http.ListenAndServe(":8080", httprouter.Chain{api, admin, static})
+//
+// The routers are tried in order with TryServeHTTP. If none of them handles a
+// request, it is answered with "404 Not Found".
+type Chain []*Router
+
+// Make sure the Chain conforms with the http.Handler interface.
+var _ http.Handler = Chain{}
+
+// ServeHTTP implements the http.Handler interface.
+func (c Chain) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	for _, router := range c {
+		if router.TryServeHTTP(w, req) {
+			return
+		}
+	}
+	http.NotFound(w, req)
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	var got string
+	handleFor := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+			got = name
+		}
+	}
+
+	first := New()
+	first.GET("/users/:id", handleFor("first"))
+	first.GET("/shared", handleFor("first"))
+	first.HandleNext("GET", "/declined", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string, next func()) {
+		next()
+	})
+
+	second := New()
+	second.GET("/orders/:id", handleFor("second"))
+	second.GET("/shared", handleFor("second"))
+	second.GET("/declined", handleFor("second"))
+
+	chain := Chain{first, second}
+
+	tests := []struct {
+		path string
+		name string
+		code int
+	}{
+		{"/users/1", "first", http.StatusOK},
+		{"/orders/1", "second", http.StatusOK},
+		{"/shared", "first", http.StatusOK},
+		{"/declined", "second", http.StatusOK},
+		{"/nope", "", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		got = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", test.path, nil)
+		chain.ServeHTTP(w, r)
+		if got != test.name || w.Code != test.code {
+			t.Errorf("%s: want %q with code %d, got %q with code %d", test.path, test.name, test.code, got, w.Code)
+		}
+	}
+}
+
+func TestChainMaintenance(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+	router := New()
+	router.GET("/users", handle)
+	router.GET("/health", handle)
+	router.Maintenance = &MaintenanceConfig{Allow: []string{"/health"}}
+
+	chain := Chain{router}
+	for path, code := range map[string]int{"/users": http.StatusServiceUnavailable, "/health": http.StatusOK} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", path, nil)
+		chain.ServeHTTP(w, r)
+		if w.Code != code {
+			t.Errorf("%s: want code %d like ServeHTTP, got %d", path, code, w.Code)
+		}
+	}
+}
+
+func TestChainMaxConcurrent(t *testing.T) {
+	router := New()
+	router.MaxConcurrent = 1
+	router.GET("/users", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {})
+	chain := Chain{router}
+
+	serve := func() int {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "/users", nil)
+		chain.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// Occupy the only slot like a request in flight.
+	router.acquire()
+	if code := serve(); code != http.StatusServiceUnavailable {
+		t.Errorf("request above the limit: want 503, got %d", code)
+	}
+	router.release()
+	if code := serve(); code != http.StatusOK {
+		t.Errorf("request within the limit: want 200, got %d", code)
+	}
+}
+
+func TestChainRequestID(t *testing.T) {
+	var got string
+	router := New()
+	router.RequestID.Enabled = true
+	router.GET("/users", func(_ http.ResponseWriter, r *http.Request, _ map[string]string) {
+		got = RequestIDFromContext(r.Context())
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/users", nil)
+	Chain{router}.ServeHTTP(w, r)
+	if got == "" || w.Header().Get("X-Request-ID") != got {
+		t.Errorf("want request ID in context and header, got %q and %q", got, w.Header().Get("X-Request-ID"))
+	}
+}
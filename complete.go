@@ -0,0 +1,104 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import "sort"
+
+// Complete returns the sorted registered path patterns which may match a path
+// beginning with the prefix, e.g. for the autocompletion of API paths in a
+// CLI. Wildcards are opaque: they match the prefix like a request path, and a
+// prefix ending within a wildcard is completed with the patterns having it.
+// For example "/users/4" is completed with "/users/:id" and
+// "/users/:id/posts".
+func (r *Router) Complete(prefix string) []string {
+	r.Compile()
+	var patterns []string
+	var walk func(path string, n *node)
+	walk = func(path string, n *node) {
+		path += n.path
+		switch completes(path, prefix) {
+		case noCompletion:
+			// No pattern below the node completes the prefix.
+			return
+		case fullCompletion:
+			if n.handle.len() > 0 {
+				patterns = append(patterns, path)
+			}
+		}
+		for _, child := range n.children {
+			walk(path, child)
+		}
+		if n.catchAllChild != nil {
+			walk(path, n.catchAllChild)
+		}
+	}
+	walk("", &r.node)
+
+	sort.Strings(patterns)
+	return patterns
+}
+
+// completion is the result of matching a pattern against a path prefix.
+type completion uint8
+
+const (
+	// The pattern doesn't match the prefix.
+	noCompletion completion = iota
+
+	// The pattern matches the beginning of the prefix, thus longer patterns
+	// may complete it.
+	partialCompletion
+
+	// The pattern matches the whole prefix.
+	fullCompletion
+)
+
+// completes matches the pattern against the prefix. The value of a param may
+// end anywhere before the next '/', since it may be followed by a separator
+// or a static suffix. A greedy param may span several path segments and a
+// catch-all matches the rest of the prefix.
+func completes(pattern, prefix string) completion {
+	for {
+		if len(prefix) == 0 {
+			return fullCompletion
+		}
+		if len(pattern) == 0 {
+			return partialCompletion
+		}
+
+		switch pattern[0] {
+		case '*':
+			return fullCompletion
+
+		case ':':
+			k := 1
+			for k < len(pattern) && isNameChar(pattern[k]) {
+				k++
+			}
+			greedy := k < len(pattern) && pattern[k] == '+'
+			if greedy {
+				k++
+			}
+
+			best := noCompletion
+			for end := 1; end <= len(prefix); end++ {
+				if prefix[end-1] == '/' && !greedy {
+					break
+				}
+				if c := completes(pattern[k:], prefix[end:]); c > best {
+					if best = c; best == fullCompletion {
+						break
+					}
+				}
+			}
+			return best
+
+		default:
+			if pattern[0] != prefix[0] {
+				return noCompletion
+			}
+			pattern, prefix = pattern[1:], prefix[1:]
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRouterComplete(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	for _, path := range []string{
+		"/",
+		"/search",
+		"/users",
+		"/users/:id",
+		"/users/:id/posts",
+		"/files/:name.json",
+		"/src/*filepath",
+		"/repos/:repo+/contents",
+	} {
+		router.GET(path, handle)
+	}
+	router.POST("/users", handle)
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"/us", []string{"/users", "/users/:id", "/users/:id/posts"}},
+		{"/users/", []string{"/users/:id", "/users/:id/posts"}},
+		{"/users/4", []string{"/users/:id", "/users/:id/posts"}},
+		{"/users/42/p", []string{"/users/:id/posts"}},
+		{"/users/42/x", nil},
+		{"/s", []string{"/search", "/src/*filepath"}},
+		{"/src/a/b", []string{"/src/*filepath"}},
+		{"/files/a.j", []string{"/files/:name.json"}},
+		{"/files/a/", nil},
+		{"/repos/a/b/con", []string{"/repos/:repo+/contents"}},
+		{"/x", nil},
+	}
+	for _, test := range tests {
+		if got := router.Complete(test.prefix); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Complete(%q): want %q, got %q", test.prefix, test.want, got)
+		}
+	}
+
+	if got := router.Complete(""); len(got) != 8 {
+		t.Errorf("Complete(\"\"): want all 8 patterns, got %q", got)
+	}
+}
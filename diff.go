@@ -0,0 +1,102 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import "reflect"
+
+// DiffRoutes compares the routes of two routers by method and pattern, e.g.
+// to detect routes removed unintentionally before a deployment. It returns
+// the routes of b which a doesn't have, the routes of a which b doesn't have,
+// and the routes of b whose options differ from the route of a with the same
+// method and pattern. The routes are ordered like by Router.Routes.
+//
+// Since handles can't be compared, routes only count as changed if their
+// options differ, e.g. their tags, defaults or body limits, or if the number
+// of candidate routes registered with When differs.
+func DiffRoutes(a, b *Router) (added, removed, changed []Route) {
+	ra, rb := groupRoutes(a.Routes()), groupRoutes(b.Routes())
+
+	for _, routes := range rb.order {
+		key := routeKey{routes[0].Method, routes[0].Path}
+		old, ok := ra.routes[key]
+		switch {
+		case !ok:
+			added = append(added, routes...)
+		case !sameRoutes(old, routes):
+			changed = append(changed, routes...)
+		}
+	}
+	for _, routes := range ra.order {
+		if _, ok := rb.routes[routeKey{routes[0].Method, routes[0].Path}]; !ok {
+			removed = append(removed, routes...)
+		}
+	}
+	return
+}
+
+// routeKey identifies the routes registered for a method and pattern.
+type routeKey struct {
+	method, path string
+}
+
+// routeGroups holds routes grouped by method and pattern, in the order of the
+// first route of each group.
+type routeGroups struct {
+	routes map[routeKey][]Route
+	order  [][]Route
+}
+
+// groupRoutes groups the routes, which are sorted by pattern and method.
+func groupRoutes(routes []Route) routeGroups {
+	g := routeGroups{routes: make(map[routeKey][]Route)}
+	for i := 0; i < len(routes); {
+		j := i + 1
+		for j < len(routes) && routes[j].Method == routes[i].Method && routes[j].Path == routes[i].Path {
+			j++
+		}
+		g.routes[routeKey{routes[i].Method, routes[i].Path}] = routes[i:j]
+		g.order = append(g.order, routes[i:j])
+		i = j
+	}
+	return g
+}
+
+// sameRoutes reports whether the candidate routes have the same options.
+func sameRoutes(a, b []Route) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].sameOptions(&b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameOptions reports whether the options of the routes are equal. Options
+// which are funcs are only compared by whether they are set.
+func (rt *Route) sameOptions(o *Route) bool {
+	return (rt.when == nil) == (o.when == nil) &&
+		(rt.rateLimit == nil) == (o.rateLimit == nil) &&
+		(rt.nextHandle == nil) == (o.nextHandle == nil) &&
+		(rt.panicHandler == nil) == (o.panicHandler == nil) &&
+		(rt.otherMethods == nil) == (o.otherMethods == nil) &&
+		len(rt.middleware) == len(o.middleware) &&
+		len(rt.validators) == len(o.validators) &&
+		reflect.DeepEqual(rt.defaults, o.defaults) &&
+		reflect.DeepEqual(rt.aliases, o.aliases) &&
+		reflect.DeepEqual(rt.consumes, o.consumes) &&
+		reflect.DeepEqual(rt.tags, o.tags) &&
+		rt.gzip == o.gzip &&
+		rt.gzipMinSize == o.gzipMinSize &&
+		rt.maxBodySize == o.maxBodySize &&
+		rt.requireBody == o.requireBody &&
+		rt.cacheControl == o.cacheControl &&
+		rt.noContent == o.noContent &&
+		rt.timeout == o.timeout &&
+		rt.matchPriority == o.matchPriority &&
+		rt.canonical == o.canonical &&
+		rt.matchesEmpty == o.matchesEmpty
+}
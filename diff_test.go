@@ -0,0 +1,60 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestDiffRoutes(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+	isAdmin := func(req *http.Request) bool { return req.Header.Get("X-Admin") != "" }
+
+	a := New()
+	a.GET("/users", handle)
+	a.GET("/users/:id", handle).Tag("users")
+	a.DELETE("/users/:id", handle)
+	a.POST("/upload", handle).MaxBodySize(1 << 20)
+	a.GET("/feed", handle)
+	a.GET("/static/*filepath", handle)
+
+	b := New()
+	b.GET("/users", handle)
+	b.GET("/users/:id", handle).Tag("users", "public")
+	b.PUT("/users/:id", handle)
+	b.POST("/upload", handle).MaxBodySize(1 << 20)
+	b.GET("/feed", handle).When(isAdmin)
+	b.GET("/feed", handle)
+	b.GET("/static/*filepath", handle)
+	b.GET("/health", handle)
+
+	routeIDs := func(routes []Route) []string {
+		var ids []string
+		for _, route := range routes {
+			ids = append(ids, route.Method+" "+route.Path)
+		}
+		return ids
+	}
+
+	added, removed, changed := DiffRoutes(a, b)
+	if want := []string{"GET /health", "PUT /users/:id"}; !reflect.DeepEqual(routeIDs(added), want) {
+		t.Errorf("wrong added routes: want %v, got %v", want, routeIDs(added))
+	}
+	if want := []string{"DELETE /users/:id"}; !reflect.DeepEqual(routeIDs(removed), want) {
+		t.Errorf("wrong removed routes: want %v, got %v", want, routeIDs(removed))
+	}
+	if want := []string{"GET /feed", "GET /feed", "GET /users/:id"}; !reflect.DeepEqual(routeIDs(changed), want) {
+		t.Errorf("wrong changed routes: want %v, got %v", want, routeIDs(changed))
+	}
+	if len(changed) == 3 && !reflect.DeepEqual(changed[2].Tags(), []string{"users", "public"}) {
+		t.Errorf("changed routes must be the ones of b, got tags %v", changed[2].Tags())
+	}
+
+	added, removed, changed = DiffRoutes(a, a.Snapshot())
+	if len(added)+len(removed)+len(changed) != 0 {
+		t.Errorf("snapshot differs: added %v, removed %v, changed %v", routeIDs(added), routeIDs(removed), routeIDs(changed))
+	}
+}
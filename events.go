@@ -0,0 +1,70 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// RouterEventType is the type of a RouterEvent.
+type RouterEventType uint8
+
+const (
+	// EventRegistered is sent when a route is registered.
+	EventRegistered RouterEventType = iota + 1
+
+	// EventMatched is sent when a request is dispatched to a route.
+	EventMatched
+
+	// EventNotFound is sent when a request is handled as not found.
+	EventNotFound
+)
+
+func (t RouterEventType) String() string {
+	switch t {
+	case EventRegistered:
+		return "registered"
+	case EventMatched:
+		return "matched"
+	case EventNotFound:
+		return "not found"
+	}
+	return "unknown"
+}
+
+// RouterEvent is an event sent to the Events channel of a Router.
+type RouterEvent struct {
+	Type   RouterEventType
+	Method string
+
+	// The registered path pattern of the route, which is empty for
+	// EventNotFound.
+	Pattern string
+
+	// The path of the request, which is empty for EventRegistered.
+	Path string
+
+	Time time.Time
+}
+
+// emit sends the event to the Events channel without blocking. Events are
+// dropped if the channel is full.
+func (r *Router) emit(typ RouterEventType, method, pattern, path string) {
+	if typ != EventRegistered && r.EventSampleRate > 1 &&
+		atomic.AddUint64(&r.eventSeq, 1)%uint64(r.EventSampleRate) != 1 {
+		return
+	}
+
+	select {
+	case r.Events <- RouterEvent{
+		Type:    typ,
+		Method:  method,
+		Pattern: pattern,
+		Path:    path,
+		Time:    time.Now(),
+	}:
+	default:
+	}
+}
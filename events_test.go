@@ -0,0 +1,64 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterEvents(t *testing.T) {
+	events := make(chan RouterEvent, 10)
+	router := New()
+	router.Events = events
+	router.GET("/user/:name", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {})
+
+	for _, path := range []string{"/user/gopher", "/nope"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	want := []RouterEvent{
+		{Type: EventRegistered, Method: "GET", Pattern: "/user/:name"},
+		{Type: EventMatched, Method: "GET", Pattern: "/user/:name", Path: "/user/gopher"},
+		{Type: EventNotFound, Method: "GET", Path: "/nope"},
+	}
+	for _, w := range want {
+		select {
+		case got := <-events:
+			if got.Time.IsZero() {
+				t.Errorf("%s event without time", got.Type)
+			}
+			got.Time = w.Time
+			if got != w {
+				t.Errorf("want event %+v, got %+v", w, got)
+			}
+		default:
+			t.Fatalf("missing %s event", w.Type)
+		}
+	}
+}
+
+func TestRouterEventsNonBlocking(t *testing.T) {
+	events := make(chan RouterEvent, 1)
+	router := New()
+	router.Events = events
+	router.EventSampleRate = 2
+	router.GET("/", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {})
+	<-events
+
+	// Only the first and the third request are sampled, and the third one is
+	// dropped since nobody receives the first one.
+	for i := 0; i < 4; i++ {
+		req, _ := http.NewRequest("GET", "/", nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if len(events) != 1 {
+		t.Fatalf("want 1 event, got %d", len(events))
+	}
+	if seq := router.eventSeq; seq != 4 {
+		t.Errorf("want 4 counted requests, got %d", seq)
+	}
+}
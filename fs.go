@@ -0,0 +1,129 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// noDirListingFS is a http.FileSystem which refuses to open directories
+// without an index.html, thus http.FileServer answers with 404 instead of
+// listing their content.
+type noDirListingFS struct {
+	fs http.FileSystem
+}
+
+func (fs noDirListingFS) Open(name string) (http.File, error) {
+	f, err := fs.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if stat.IsDir() {
+		index, err := fs.fs.Open(strings.TrimSuffix(name, "/") + "/index.html")
+		if err != nil {
+			f.Close()
+			return nil, os.ErrNotExist
+		}
+		index.Close()
+	}
+
+	return f, nil
+}
+
+// ServeReaderSeeker serves the content like a file served with ServeFiles, for
+// handles serving files from other sources, e.g. a database. It is a
+// shortcut for http.ServeContent, which handles Range, If-Range and the
+// conditional request headers based on modtime, and detects the Content-Type
+// from the extension of name or the content, unless it is set already.
+func ServeReaderSeeker(w http.ResponseWriter, r *http.Request, name string, modtime time.Time, content io.ReadSeeker) {
+	http.ServeContent(w, r, name, modtime, content)
+}
+
+// cleanFilePath returns the path of the file the file server opens for the
+// value p of the catch-all, i.e. p with "." and ".." elements and repeated
+// slashes resolved. A trailing slash is kept, it tells the file server that a
+// directory is requested.
+func cleanFilePath(p string) string {
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// serveGzipFile serves the precompressed variant name.gz of the file if it
+// exists in root, with the Content-Type of the file. It reports whether the
+// variant was served. The name must be cleaned by cleanFilePath.
+func serveGzipFile(w http.ResponseWriter, req *http.Request, root http.FileSystem, name string) bool {
+	if strings.HasSuffix(name, "/") {
+		return false
+	}
+	f, err := root.Open(name + ".gz")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil || stat.IsDir() {
+		return false
+	}
+
+	ctype := mime.TypeByExtension(path.Ext(name))
+	if ctype == "" {
+		// Detecting the type would sniff the compressed content.
+		ctype = "application/octet-stream"
+	}
+	h := w.Header()
+	h.Set("Content-Type", ctype)
+	h.Set("Content-Encoding", "gzip")
+	http.ServeContent(w, req, name, stat.ModTime(), f)
+	return true
+}
+
+// spaHandler serves the files of a single page application. Requests for
+// paths which don't exist are answered with the index.html of the root, thus
+// the application can handle them on the client side.
+type spaHandler struct {
+	root  http.FileSystem
+	files http.Handler
+}
+
+func newSPAHandler(root http.FileSystem) spaHandler {
+	root = noDirListingFS{root}
+	return spaHandler{
+		root:  root,
+		files: http.FileServer(root),
+	}
+}
+
+func (h spaHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if f, err := h.root.Open(path.Clean("/" + req.URL.Path)); err == nil {
+		f.Close()
+		h.files.ServeHTTP(w, req)
+		return
+	}
+
+	// Serve the index.html of the root.
+	req2 := new(http.Request)
+	*req2 = *req
+	req2.URL = new(url.URL)
+	*req2.URL = *req.URL
+	req2.URL.Path = "/"
+	h.files.ServeHTTP(w, req2)
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeReaderSeeker(t *testing.T) {
+	modtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	router := New()
+	router.GET("/media/:tenant/:name", func(w http.ResponseWriter, req *http.Request, vars map[string]string) {
+		content := strings.NewReader("0123456789")
+		ServeReaderSeeker(w, req, vars["name"], modtime, content)
+	})
+
+	tests := []struct {
+		header       map[string]string
+		code         int
+		contentRange string
+		body         string
+	}{
+		{nil, http.StatusOK, "", "0123456789"},
+		{map[string]string{"Range": "bytes=2-5"}, http.StatusPartialContent, "bytes 2-5/10", "2345"},
+		{map[string]string{"Range": "bytes=-3"}, http.StatusPartialContent, "bytes 7-9/10", "789"},
+		{map[string]string{"Range": "bytes=20-"}, http.StatusRequestedRangeNotSatisfiable, "bytes */10", ""},
+		{map[string]string{"Range": "bytes=2-5", "If-Range": modtime.Add(-time.Hour).Format(http.TimeFormat)},
+			http.StatusOK, "", "0123456789"},
+		{map[string]string{"If-Modified-Since": modtime.Format(http.TimeFormat)}, http.StatusNotModified, "", ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/media/acme/clip.txt", nil)
+		for key, value := range test.header {
+			req.Header.Set(key, value)
+		}
+		router.ServeHTTP(w, req)
+		if w.Code != test.code || w.Header().Get("Content-Range") != test.contentRange {
+			t.Errorf("%v: want %d with Content-Range %q, got %d with %q",
+				test.header, test.code, test.contentRange, w.Code, w.Header().Get("Content-Range"))
+		}
+		if test.code != http.StatusRequestedRangeNotSatisfiable && w.Body.String() != test.body {
+			t.Errorf("%v: want body %q, got %q", test.header, test.body, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// acceptsGzip reports whether the client accepts gzip compressed responses.
+func acceptsGzip(req *http.Request) bool {
+	for _, field := range req.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(field, ",") {
+			name, params, _ := strings.Cut(coding, ";")
+			name = strings.TrimSpace(name)
+			if name != "gzip" && name != "*" {
+				continue
+			}
+			if _, q, ok := strings.Cut(params, "q="); ok {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(q), 64); err == nil && v == 0 {
+					continue
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// headerHasToken reports whether the comma-separated values of the header
+// contain the token.
+func headerHasToken(h http.Header, key, token string) bool {
+	for _, field := range h.Values(key) {
+		for _, v := range strings.Split(field, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isCompressedType reports whether the content type is compressed already,
+// so that compressing it again is wasted effort.
+func isCompressedType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "video/"):
+		return true
+	}
+	switch mediaType {
+	case "application/gzip", "application/x-gzip", "application/zip", "application/zstd",
+		"application/x-7z-compressed", "application/x-rar-compressed", "application/x-bzip2",
+		"font/woff", "font/woff2":
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter compresses the response body with gzip. The body is
+// buffered until it reaches minSize, then the writer decides whether to
+// compress it: responses with a Content-Encoding or a compressed content
+// type and responses shorter than minSize are written as they are.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+
+	code    int
+	written bool
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func newGzipResponseWriter(w http.ResponseWriter, minSize int) *gzipResponseWriter {
+	return &gzipResponseWriter{ResponseWriter: w, minSize: minSize, code: http.StatusOK}
+}
+
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if !w.decided {
+		w.code = code
+		w.written = true
+	}
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.written = true
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < w.minSize || len(w.buf) == 0 {
+			return len(p), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide writes the header and the buffered body, compressed if the
+// response qualifies for compression.
+func (w *gzipResponseWriter) decide() error {
+	w.decided = true
+
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		// Detect the type of the plain body, as the server would.
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	compress := len(w.buf) > 0 && len(w.buf) >= w.minSize &&
+		w.code != http.StatusNoContent && w.code != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" && !isCompressedType(h.Get("Content-Type"))
+
+	if compress {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		w.ResponseWriter.WriteHeader(w.code)
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+		_, err := w.gz.Write(w.buf)
+		w.buf = nil
+		return err
+	}
+
+	w.ResponseWriter.WriteHeader(w.code)
+	_, err := w.ResponseWriter.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// Flush writes the buffered response and flushes it to the client.
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		w.decide()
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close writes the rest of the response, if anything was written.
+func (w *gzipResponseWriter) Close() error {
+	if !w.written {
+		return nil
+	}
+	if !w.decided {
+		if err := w.decide(); err != nil {
+			return err
+		}
+	}
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
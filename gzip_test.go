@@ -0,0 +1,140 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouteGzip(t *testing.T) {
+	body := strings.Repeat(`{"name":"gopher"},`, 100)
+	handleWith := func(contentType, body string) Handle {
+		return func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+			if contentType != "" {
+				w.Header().Set("Content-Type", contentType)
+			}
+			io.WriteString(w, body)
+		}
+	}
+
+	router := New()
+	router.GET("/json", handleWith("application/json", body)).Gzip()
+	router.GET("/plain", handleWith("", body)).Gzip()
+	router.GET("/png", handleWith("image/png", body)).Gzip()
+	router.GET("/small", handleWith("application/json", "{}")).GzipMinSize(1024)
+	router.GET("/large", handleWith("application/json", body)).GzipMinSize(1024)
+	router.GET("/empty", func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		w.WriteHeader(http.StatusNoContent)
+	}).Gzip()
+	router.GET("/off", handleWith("application/json", body))
+
+	tests := []struct {
+		path           string
+		acceptEncoding string
+		compressed     bool
+		body           string
+	}{
+		{"/json", "gzip", true, body},
+		{"/json", "deflate, gzip;q=0.8", true, body},
+		{"/json", "*", true, body},
+		{"/json", "", false, body},
+		{"/json", "deflate", false, body},
+		{"/json", "gzip;q=0", false, body},
+		{"/plain", "gzip", true, body},
+		{"/png", "gzip", false, body},
+		{"/small", "gzip", false, "{}"},
+		{"/large", "gzip", true, body},
+		{"/empty", "gzip", false, ""},
+		{"/off", "gzip", false, body},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", test.path, nil)
+		if test.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", test.acceptEncoding)
+		}
+		router.ServeHTTP(w, req)
+
+		compressed := w.Header().Get("Content-Encoding") == "gzip"
+		if compressed != test.compressed {
+			t.Errorf("%s with Accept-Encoding %q: want compressed=%t, got %t",
+				test.path, test.acceptEncoding, test.compressed, compressed)
+			continue
+		}
+		if vary := w.Header().Get("Vary"); (vary == "Accept-Encoding") != (test.path != "/off") {
+			t.Errorf("%s: wrong Vary header %q", test.path, vary)
+		}
+
+		got := w.Body.String()
+		if compressed {
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("%s: %v", test.path, err)
+			}
+			b, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("%s: %v", test.path, err)
+			}
+			got = string(b)
+		}
+		if got != test.body {
+			t.Errorf("%s with Accept-Encoding %q: wrong body %.40q", test.path, test.acceptEncoding, got)
+		}
+	}
+
+	// The content type of the uncompressed body is detected.
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/plain", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	router.ServeHTTP(w, req)
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("wrong content type: %q", ct)
+	}
+}
+
+func TestRouteGzipDeclined(t *testing.T) {
+	router := New()
+	router.HandleNext("GET", "/x", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string, next func()) {
+		next()
+	}).Gzip()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/x", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("want uncompressed 404, got %d with Content-Encoding %q", w.Code, w.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestRouteGzipPanic(t *testing.T) {
+	handle := func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		w.Write([]byte("partial"))
+		panic("oops")
+	}
+	recovered := func(w http.ResponseWriter, _ *http.Request, _ interface{}) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	router := New()
+	router.PanicHandler = recovered
+	router.GET("/router", handle).GzipMinSize(1024)
+	router.GET("/route", handle).GzipMinSize(1024).Recover(recovered)
+
+	for _, path := range []string{"/router", "/route"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusInternalServerError || w.Body.Len() != 0 {
+			t.Errorf("%s: buffered response flushed on panic: got %d %q", path, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"net/http"
+	"strings"
+)
+
+// matchHost matches the host against the pattern label by label and returns
+// the values of the parameters of the pattern. Labels are compared
+// case-insensitively, a port and a trailing dot of the host are ignored.
+// A parameter matches a single non-empty label, e.g. :tenant.example.com
+// matches acme.example.com, but neither example.com nor a.b.example.com.
+func matchHost(pattern, host string) (vars map[string]string, ok bool) {
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+	host = strings.TrimSuffix(host, ".")
+
+	for {
+		pLabel, pRest, pMore := strings.Cut(pattern, ".")
+		hLabel, hRest, hMore := strings.Cut(host, ".")
+		if len(pLabel) > 1 && pLabel[0] == ':' {
+			if len(hLabel) == 0 {
+				return nil, false
+			}
+			if vars == nil {
+				vars = make(map[string]string)
+			}
+			vars[pLabel[1:]] = hLabel
+		} else if !strings.EqualFold(pLabel, hLabel) {
+			return nil, false
+		}
+
+		if pMore != hMore {
+			return nil, false
+		}
+		if !pMore {
+			return vars, true
+		}
+		pattern, host = pRest, hRest
+	}
+}
+
+// hostVars matches the host of the request against the HostPattern of the
+// router. It reports false if the host doesn't match.
+func (r *Router) hostVars(req *http.Request) (map[string]string, bool) {
+	if r.HostPattern == "" {
+		return nil, true
+	}
+	return matchHost(r.HostPattern, req.Host)
+}
+
+// mergeVars adds the host parameters to the values of the path wildcards.
+// Path wildcards take precedence over host parameters of the same name.
+func mergeVars(vars, hostVars map[string]string) map[string]string {
+	if len(hostVars) == 0 {
+		return vars
+	}
+	if vars == nil {
+		vars = make(map[string]string, len(hostVars))
+	}
+	for name, value := range hostVars {
+		if _, ok := vars[name]; !ok {
+			vars[name] = value
+		}
+	}
+	return vars
+}
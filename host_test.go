@@ -0,0 +1,92 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestMatchHost(t *testing.T) {
+	tests := []struct {
+		pattern, host string
+		ok            bool
+		vars          map[string]string
+	}{
+		{":tenant.example.com", "acme.example.com", true, map[string]string{"tenant": "acme"}},
+		{":tenant.example.com", "acme.example.com:8080", true, map[string]string{"tenant": "acme"}},
+		{":tenant.example.com", "Acme.EXAMPLE.com.", true, map[string]string{"tenant": "Acme"}},
+		{":tenant.example.com", "example.com", false, nil},
+		{":tenant.example.com", ".example.com", false, nil},
+		{":tenant.example.com", "a.b.example.com", false, nil},
+		{":tenant.example.com", "acme.example.org", false, nil},
+		{":tenant.:region.example.com", "acme.eu.example.com", true, map[string]string{"tenant": "acme", "region": "eu"}},
+		{"api.example.com", "API.example.com", true, nil},
+		{"api.example.com", "www.example.com", false, nil},
+		{":host", "[::1]:8080", true, map[string]string{"host": "[::1]"}},
+	}
+
+	for _, test := range tests {
+		vars, ok := matchHost(test.pattern, test.host)
+		if ok != test.ok || !reflect.DeepEqual(vars, test.vars) {
+			t.Errorf("matchHost(%q, %q): want %v %t, got %v %t", test.pattern, test.host, test.vars, test.ok, vars, ok)
+		}
+	}
+}
+
+func TestRouterHostPattern(t *testing.T) {
+	handle := func(w http.ResponseWriter, _ *http.Request, vars map[string]string) {
+		fmt.Fprintf(w, "%s/%s", vars["tenant"], vars["id"])
+	}
+
+	router := New()
+	router.HostPattern = ":tenant.example.com"
+	router.GET("/users/:id", handle)
+	router.GET("/tenants/:tenant", handle)
+	router.GET("/", handle)
+
+	apex := New()
+	apex.GET("/users/:id", func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		fmt.Fprint(w, "apex")
+	})
+	chain := Chain{router, apex}
+
+	tests := []struct {
+		host, path string
+		code       int
+		body       string
+	}{
+		{"acme.example.com", "/users/42", http.StatusOK, "acme/42"},
+		{"acme.example.com:8443", "/", http.StatusOK, "acme/"},
+		{"acme.example.com", "/tenants/other", http.StatusOK, "other/"},
+		{"acme.example.com", "/nope", http.StatusNotFound, ""},
+		{"example.com", "/users/42", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "http://"+test.host+test.path, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != test.code || test.code == http.StatusOK && w.Body.String() != test.body {
+			t.Errorf("%s%s: want %d %q, got %d %q", test.host, test.path, test.code, test.body, w.Code, w.Body.String())
+		}
+	}
+
+	// Requests for other hosts fall through to the next router of a Chain.
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://example.com/users/42", nil)
+	chain.ServeHTTP(w, req)
+	if w.Body.String() != "apex" {
+		t.Errorf("Chain: want the apex router to handle the request, got %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "http://acme.example.com/users/42", nil)
+	chain.ServeHTTP(w, req)
+	if w.Body.String() != "acme/42" {
+		t.Errorf("Chain: want the tenant router to handle the request, got %d %q", w.Code, w.Body.String())
+	}
+}
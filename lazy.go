@@ -0,0 +1,106 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// pendingRoute is a route registered with LazyCompile, which isn't inserted
+// into the tree yet.
+type pendingRoute struct {
+	method, path string
+	route        *Route
+}
+
+// lazyRoutes holds the pending routes of a Router with LazyCompile, grouped
+// by the first segment of their path. Routes whose first segment contains a
+// wildcard are grouped under "*", since they may match any request path.
+//
+// Once routes are pending, the tree is modified while requests are served,
+// thus all lookups hold the read lock and compiling holds the write lock.
+// Once all routes are compiled, lookups skip the lock again.
+type lazyRoutes struct {
+	mu      sync.RWMutex
+	pending map[string][]pendingRoute
+	count   int64 // the number of pending routes, accessed atomically
+}
+
+// firstSegment returns the group of the path, which is its first segment or
+// "*" if the segment contains a wildcard.
+func firstSegment(path string) string {
+	seg := strings.TrimPrefix(path, "/")
+	if i := strings.IndexByte(seg, '/'); i >= 0 {
+		seg = seg[:i]
+	}
+	if strings.ContainsAny(seg, ":*") {
+		return "*"
+	}
+	return seg
+}
+
+// add records the route as pending.
+func (l *lazyRoutes) add(method, path string, route *Route) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pending == nil {
+		l.pending = make(map[string][]pendingRoute)
+	}
+	seg := firstSegment(path)
+	l.pending[seg] = append(l.pending[seg], pendingRoute{method, path, route})
+	atomic.AddInt64(&l.count, 1)
+}
+
+// active reports whether any routes are pending, thus whether lookups must
+// hold the read lock.
+func (l *lazyRoutes) active() bool {
+	return l != nil && atomic.LoadInt64(&l.count) > 0
+}
+
+// needs reports whether routes which may match the path are pending.
+func (l *lazyRoutes) needs(path string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.pending[firstSegment(path)]) > 0 || len(l.pending["*"]) > 0
+}
+
+// compileFor inserts the pending routes which may match the path into the
+// tree of the router.
+func (r *Router) compileFor(path string) {
+	if !r.lazy.active() || !r.lazy.needs(path) {
+		return
+	}
+	r.lazy.mu.Lock()
+	defer r.lazy.mu.Unlock()
+	r.compileGroup(firstSegment(path))
+	r.compileGroup("*")
+}
+
+// compileGroup inserts the pending routes of the group into the tree. The
+// write lock must be held.
+func (r *Router) compileGroup(seg string) {
+	routes := r.lazy.pending[seg]
+	delete(r.lazy.pending, seg)
+	for _, p := range routes {
+		r.addRoute(p.method, p.path, p.route)
+	}
+	atomic.AddInt64(&r.lazy.count, -int64(len(routes)))
+}
+
+// Compile inserts all routes registered with LazyCompile into the tree. It
+// can be called once all routes are registered, e.g. in tests, to detect
+// conflicting routes, which otherwise panic when the first request that
+// may match them is served.
+func (r *Router) Compile() {
+	if r.lazy == nil {
+		return
+	}
+	r.lazy.mu.Lock()
+	defer r.lazy.mu.Unlock()
+	for seg := range r.lazy.pending {
+		r.compileGroup(seg)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRouterLazyCompile(t *testing.T) {
+	var got string
+	var gotVars map[string]string
+	handleFor := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, vars map[string]string) {
+			got, gotVars = name, vars
+		}
+	}
+
+	routes := []string{"/users", "/users/:id", "/orders/", "/orders/:id/items", "/src/*filepath", "/*root"}
+	eager, lazy := New(), New()
+	lazy.LazyCompile = true
+	for _, router := range []*Router{eager, lazy} {
+		for _, route := range routes {
+			router.GET(route, handleFor(route))
+		}
+	}
+
+	if lazy.lazy == nil || len(lazy.lazy.pending) == 0 {
+		t.Fatal("routes compiled at registration")
+	}
+
+	for _, path := range []string{"/", "/users", "/users/", "/users/42", "/orders", "/orders/7/items", "/src/a/b", "/src", "/x"} {
+		var want, wantLocation string
+		var wantVars map[string]string
+		for _, router := range []*Router{eager, lazy} {
+			got, gotVars = "", nil
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			router.ServeHTTP(w, req)
+			if router == eager {
+				want, wantVars, wantLocation = got, gotVars, w.Header().Get("Location")
+			} else if got != want || !reflect.DeepEqual(gotVars, wantVars) || w.Header().Get("Location") != wantLocation {
+				t.Errorf("%s: want %q %v %q like the eager router, got %q %v %q",
+					path, want, wantVars, wantLocation, got, gotVars, w.Header().Get("Location"))
+			}
+		}
+	}
+
+	// Introspection compiles all routes.
+	if lazy.NumRoutes() != len(routes) || len(lazy.lazy.pending) != 0 {
+		t.Errorf("wrong number of routes: want %d, got %d", len(routes), lazy.NumRoutes())
+	}
+	if lazy.DumpTree() != eager.DumpTree() {
+		t.Errorf("tree differs from the eager router:\n%s\n%s", lazy.DumpTree(), eager.DumpTree())
+	}
+
+	// Conflicts are detected when the routes are compiled.
+	lazy.GET("/users/:name/x", handleFor("conflict"))
+	if recv := catchPanic(lazy.Compile); recv == nil {
+		t.Error("no panic compiling conflicting route")
+	}
+}
+
+func TestRouterLazyCompileConcurrent(t *testing.T) {
+	router := New()
+	router.LazyCompile = true
+	for i := 0; i < 100; i++ {
+		s := strconv.Itoa(i)
+		router.GET("/r"+s+"/:id", func(w http.ResponseWriter, _ *http.Request, vars map[string]string) {
+			w.Write([]byte(s + vars["id"]))
+		})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s := strconv.Itoa(i)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/r"+s+"/x", nil)
+			router.ServeHTTP(w, req)
+			if w.Body.String() != s+"x" {
+				t.Errorf("/r%s/x: wrong body %q", s, w.Body.String())
+			}
+			// Looking up a pattern compiles and reads other groups.
+			pattern := "/r" + strconv.Itoa(99-i) + "/:id"
+			if _, ok := router.HandlerFor("GET", pattern); !ok {
+				t.Errorf("%s: no handle found", pattern)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestRouterLazyCompileUnlocked(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+	router := New()
+	router.LazyCompile = true
+	router.GET("/users/:id", handle)
+	router.GET("/posts/:id", handle)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/1", nil))
+	if !router.lazy.active() {
+		t.Fatal("lookups skip the lock while routes are pending")
+	}
+	router.Compile()
+	if router.lazy.active() {
+		t.Fatal("lookups hold the lock after all routes are compiled")
+	}
+
+	// With nothing pending, lookups don't wait for the lock.
+	router.lazy.mu.Lock()
+	defer router.lazy.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		router.Lookup("GET", "/posts/1")
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("lookup blocked on the lock after all routes are compiled")
+	}
+}
+
+// registerManyRoutes registers 10000 routes with different first segments.
+func registerManyRoutes(router *Router) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+	for i := 0; i < 2000; i++ {
+		prefix := "/svc" + strconv.Itoa(i)
+		router.GET(prefix+"/items", handle)
+		router.POST(prefix+"/items", handle)
+		router.GET(prefix+"/items/:id", handle)
+		router.PUT(prefix+"/items/:id", handle)
+		router.GET(prefix+"/items/:id/history", handle)
+	}
+}
+
+func BenchmarkRouterRegisterEager(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		registerManyRoutes(New())
+	}
+}
+
+func BenchmarkRouterRegisterLazy(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		router := New()
+		router.LazyCompile = true
+		registerManyRoutes(router)
+	}
+}
+
+func BenchmarkRouterParamEager(b *testing.B) {
+	router := New()
+	registerManyRoutes(router)
+	r, _ := http.NewRequest("GET", "/svc42/items/7/history", nil)
+	benchRequest(b, router, r)
+}
+
+func BenchmarkRouterParamLazy(b *testing.B) {
+	router := New()
+	router.LazyCompile = true
+	registerManyRoutes(router)
+	r, _ := http.NewRequest("GET", "/svc42/items/7/history", nil)
+	benchRequest(b, router, r)
+}
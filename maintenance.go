@@ -0,0 +1,60 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// MaintenanceConfig configures the maintenance mode of a Router, in which all
+// requests are answered with "503 Service Unavailable" without being
+// dispatched, except for the requests of the allowed paths.
+type MaintenanceConfig struct {
+	// The time after which clients should retry, which is sent in the
+	// Retry-After header in seconds. If it is 0, the header is not sent.
+	RetryAfter time.Duration
+
+	// The request paths which are still dispatched, e.g. health checks.
+	// Paths must match exactly.
+	Allow []string
+
+	// The body of the responses and its Content-Type. If the body is empty,
+	// the responses are written in the ErrorFormat of the router. If the
+	// Content-Type is empty, "text/plain; charset=utf-8" is used.
+	Body        string
+	ContentType string
+}
+
+// allows reports whether requests for the path are dispatched.
+func (m *MaintenanceConfig) allows(path string) bool {
+	for _, p := range m.Allow {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// serveMaintenance answers the request according to the maintenance config.
+func (r *Router) serveMaintenance(w http.ResponseWriter, req *http.Request, m *MaintenanceConfig) {
+	if m.RetryAfter > 0 {
+		secs := (m.RetryAfter + time.Second - 1) / time.Second
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(secs), 10))
+	}
+	if m.Body == "" {
+		r.writeError(w, req, http.StatusServiceUnavailable)
+		return
+	}
+
+	ctype := m.ContentType
+	if ctype == "" {
+		ctype = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.WriteHeader(http.StatusServiceUnavailable)
+	io.WriteString(w, m.Body)
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouterMaintenance(t *testing.T) {
+	handle := func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		io.WriteString(w, "ok")
+	}
+	router := New()
+	router.GET("/users", handle)
+	router.GET("/healthz", handle)
+
+	serve := func(r *Router, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	router.Maintenance = &MaintenanceConfig{
+		RetryAfter: 90500 * time.Millisecond,
+		Allow:      []string{"/healthz"},
+		Body:       "down for maintenance",
+	}
+	tests := []struct {
+		path       string
+		code       int
+		retryAfter string
+		body       string
+	}{
+		{"/users", http.StatusServiceUnavailable, "91", "down for maintenance"},
+		{"/nope", http.StatusServiceUnavailable, "91", "down for maintenance"},
+		{"/healthz", http.StatusOK, "", "ok"},
+	}
+	for _, test := range tests {
+		w := serve(router, test.path)
+		if w.Code != test.code || w.Header().Get("Retry-After") != test.retryAfter || w.Body.String() != test.body {
+			t.Errorf("%s: want %d %q %q, got %d %q %q", test.path, test.code, test.retryAfter, test.body,
+				w.Code, w.Header().Get("Retry-After"), w.Body.String())
+		}
+	}
+
+	router.Maintenance = &MaintenanceConfig{}
+	if w := serve(router, "/users"); w.Code != http.StatusServiceUnavailable ||
+		w.Header().Get("Retry-After") != "" || w.Body.String() != "Service Unavailable\n" {
+		t.Errorf("default maintenance response: got %d %q %q", w.Code, w.Header().Get("Retry-After"), w.Body.String())
+	}
+
+	router.Maintenance = nil
+	if w := serve(router, "/users"); w.Code != http.StatusOK {
+		t.Errorf("maintenance off: want 200, got %d", w.Code)
+	}
+
+	// Switching the mode while requests are served.
+	s := router.Snapshot()
+	s.Maintenance = &MaintenanceConfig{}
+	router.Install(s)
+	if w := serve(router, "/users"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("maintenance snapshot installed: want 503, got %d", w.Code)
+	}
+	router.Install(nil)
+	if w := serve(router, "/users"); w.Code != http.StatusOK {
+		t.Errorf("maintenance snapshot removed: want 200, got %d", w.Code)
+	}
+}
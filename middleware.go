@@ -0,0 +1,72 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+// Middleware wraps a Handle, e.g. to authenticate requests before the handle
+// is invoked or to log them afterwards.
+type Middleware func(Handle) Handle
+
+// scopedMiddleware is a middleware of a route, which only applies to requests
+// with one of the methods, or to all requests if methods is nil.
+type scopedMiddleware struct {
+	methods []string
+	mw      Middleware
+}
+
+// Use adds middleware which is applied to the handles of all routes. It is
+// applied in the order it is added, outside of the middleware of the routes.
+func (r *Router) Use(mw ...Middleware) {
+	r.middleware = append(r.middleware, mw...)
+}
+
+// Use adds middleware which is applied to the handle of the route, in the
+// order it is added.
+func (rt *Route) Use(mw ...Middleware) *Route {
+	for _, m := range mw {
+		rt.middleware = append(rt.middleware, scopedMiddleware{mw: m})
+	}
+	return rt
+}
+
+// MiddlewareFor adds middleware which is applied to the handle of the route
+// for requests with one of the given methods only. It allows to configure
+// the routes of a path alike for all methods, e.g.:
+//
+//	for _, method := range []string{"GET", "POST", "DELETE"} {
+//		router.Handle(method, "/items/:id", items).
+//			MiddlewareFor([]string{"POST", "PUT", "DELETE"}, auth)
+//	}
+func (rt *Route) MiddlewareFor(methods []string, mw ...Middleware) *Route {
+	for _, m := range mw {
+		rt.middleware = append(rt.middleware, scopedMiddleware{methods: methods, mw: m})
+	}
+	return rt
+}
+
+// applies reports whether the middleware applies to requests with the method.
+func (m scopedMiddleware) applies(method string) bool {
+	if m.methods == nil {
+		return true
+	}
+	for _, mm := range m.methods {
+		if mm == method {
+			return true
+		}
+	}
+	return false
+}
+
+// applyMiddleware wraps the handle with the middleware of the route which
+// applies to the method and with the middleware of the router.
+func (r *Router) applyMiddleware(route *Route, method string, handle Handle) Handle {
+	for i := len(route.middleware) - 1; i >= 0; i-- {
+		if route.middleware[i].applies(method) {
+			handle = route.middleware[i].mw(handle)
+		}
+	}
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handle = r.middleware[i](handle)
+	}
+	return handle
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRouterMiddleware(t *testing.T) {
+	var calls []string
+	mwFor := func(name string) Middleware {
+		return func(next Handle) Handle {
+			return func(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+				calls = append(calls, name)
+				next(w, r, vars)
+			}
+		}
+	}
+	handle := func(_ http.ResponseWriter, r *http.Request, _ map[string]string) {
+		calls = append(calls, "handle")
+	}
+
+	router := New()
+	router.Use(mwFor("global1"), mwFor("global2"))
+	for _, method := range []string{"GET", "POST", "DELETE"} {
+		router.Handle(method, "/items/:id", handle).
+			Use(mwFor("log")).
+			MiddlewareFor([]string{"POST", "PUT", "DELETE"}, mwFor("auth"))
+	}
+	router.GET("/plain", handle)
+
+	tests := []struct {
+		method string
+		path   string
+		calls  []string
+	}{
+		{"GET", "/items/1", []string{"global1", "global2", "log", "handle"}},
+		{"POST", "/items/1", []string{"global1", "global2", "log", "auth", "handle"}},
+		{"DELETE", "/items/1", []string{"global1", "global2", "log", "auth", "handle"}},
+		{"GET", "/plain", []string{"global1", "global2", "handle"}},
+	}
+
+	for _, test := range tests {
+		calls = nil
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(w, r)
+		if !reflect.DeepEqual(calls, test.calls) {
+			t.Errorf("%s %s: want calls %v, got %v", test.method, test.path, test.calls, calls)
+		}
+	}
+}
+
+func TestRouterMiddlewareShortCircuit(t *testing.T) {
+	deny := func(next Handle) Handle {
+		return func(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+			if r.Header.Get("Authorization") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next(w, r, vars)
+		}
+	}
+
+	routed := false
+	router := New()
+	router.POST("/items", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		routed = true
+	}).MiddlewareFor([]string{"POST"}, deny)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/items", nil)
+	router.ServeHTTP(w, r)
+	if routed || w.Code != http.StatusUnauthorized {
+		t.Errorf("middleware didn't deny the request: routed=%t, code=%d", routed, w.Code)
+	}
+}
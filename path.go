@@ -3,6 +3,8 @@
 
 package httprouter
 
+import "strings"
+
 // CleanPath is the URL version of path.Clean, it returns a canonical URL path
 // for p, elimination . and .. elements.
 //
@@ -14,6 +16,10 @@ package httprouter
 //     along with the non-.. element that precedes it.
 //  4. Eliminate .. elements that begin a routed path:
 //     that is, replace "/.." by "/" at the beginning of a path.
+//
+// A path without a leading '/' is treated as if it had one, thus the result
+// always begins with '/' and never escapes the root, e.g. "/../../a" and
+// "../a" both result in "/a".
 func CleanPath(p string) string {
 	if p == "" {
 		return "/"
@@ -100,6 +106,23 @@ func CleanPath(p string) string {
 	return string(buf[:w])
 }
 
+// mergeSlashes replaces consecutive slashes in p by a single one. Unlike
+// CleanPath, it doesn't interpret the elements of the path.
+func mergeSlashes(p string) string {
+	i := strings.Index(p, "//")
+	if i < 0 {
+		return p
+	}
+
+	buf := []byte(p[:i+1])
+	for ; i < len(p); i++ {
+		if p[i] != '/' || buf[len(buf)-1] != '/' {
+			buf = append(buf, p[i])
+		}
+	}
+	return string(buf)
+}
+
 // Internal helper to lazily create a buffer if necessary.
 func bufApp(buf *[]byte, s string, w int, c byte) {
 	if *buf == nil {
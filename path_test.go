@@ -5,6 +5,7 @@ package httprouter
 
 import (
 	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -55,6 +56,20 @@ var cleanTests = []struct {
 	{"/abc/def/../../../", "/"},
 	{"/abc/def/../../../ghi/jkl/../../../mno", "/mno"},
 
+	// Remove .. elements at the root.
+	{"/..", "/"},
+	{"/../", "/"},
+	{"/../..", "/"},
+	{"/../../", "/"},
+	{"/../abc", "/abc"},
+	{"/../../abc", "/abc"},
+	{"/../../abc/", "/abc/"},
+	{"/../abc/../..", "/"},
+	{"/abc/../../def", "/def"},
+	{"/./../abc", "/abc"},
+	{"..abc", "/..abc"},
+	{"/.../abc", "/.../abc"},
+
 	// Combinations.
 	{"abc/./../def", "/def"},
 	{"abc//./../def", "/def"},
@@ -72,6 +87,36 @@ func TestPathClean(t *testing.T) {
 	}
 }
 
+func TestPathCleanRoot(t *testing.T) {
+	// Paths beginning with any combination of . and .. elements never escape
+	// the root.
+	elements := []string{"..", ".", "", "abc"}
+	var paths []string
+	for _, a := range elements {
+		for _, b := range elements {
+			for _, c := range elements {
+				path := a + "/" + b + "/" + c
+				paths = append(paths, path, "/"+path, path+"/..")
+			}
+		}
+	}
+
+	for _, path := range paths {
+		s := CleanPath(path)
+		if s[0] != '/' {
+			t.Errorf("CleanPath(%q) = %q, doesn't begin with '/'", path, s)
+		}
+		for _, element := range strings.Split(s, "/") {
+			if element == ".." || element == "." {
+				t.Errorf("CleanPath(%q) = %q, contains a %q element", path, s, element)
+			}
+		}
+		if CleanPath(s) != s {
+			t.Errorf("CleanPath(%q) = %q, which isn't clean", path, s)
+		}
+	}
+}
+
 func TestPathCleanMallocs(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping malloc count in short mode")
@@ -88,3 +133,23 @@ func TestPathCleanMallocs(t *testing.T) {
 		}
 	}
 }
+
+func TestMergeSlashes(t *testing.T) {
+	tests := []struct {
+		path, result string
+	}{
+		{"/", "/"},
+		{"//", "/"},
+		{"/a/b", "/a/b"},
+		{"/a//b", "/a/b"},
+		{"/a///b", "/a/b"},
+		{"//a//b//", "/a/b/"},
+		{"/a/./b", "/a/./b"},
+	}
+
+	for _, test := range tests {
+		if s := mergeSlashes(test.path); s != test.result {
+			t.Errorf("mergeSlashes(%q) = %q, want %q", test.path, s, test.result)
+		}
+	}
+}
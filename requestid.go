@@ -0,0 +1,68 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDConfig configures the request IDs of a Router. If enabled, the
+// router takes the ID of each request from the request header, or generates
+// a new one if the header is missing, before the request is dispatched. The
+// ID is stored in the request context, see RequestIDFromContext, and echoed
+// in the response header.
+type RequestIDConfig struct {
+	// Enables request IDs.
+	Enabled bool
+
+	// The request and response header carrying the ID. If it is empty,
+	// "X-Request-ID" is used.
+	Header string
+
+	// Generates a new ID. If it is nil, 16 random bytes encoded in
+	// hexadecimal are used.
+	Generate func() string
+}
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the ID of the request with the context, or an
+// empty string if request IDs aren't enabled.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// attach stores the ID of the request in its context and in the response
+// header.
+func (c RequestIDConfig) attach(w http.ResponseWriter, req *http.Request) *http.Request {
+	header := c.Header
+	if header == "" {
+		header = "X-Request-ID"
+	}
+
+	id := req.Header.Get(header)
+	if id == "" {
+		if c.Generate != nil {
+			id = c.Generate()
+		} else {
+			id = newRequestID()
+		}
+	}
+
+	w.Header().Set(header, id)
+	return req.WithContext(context.WithValue(req.Context(), requestIDKey{}, id))
+}
+
+// newRequestID returns 16 random bytes encoded in hexadecimal.
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("httprouter: can't generate request ID: " + err.Error())
+	}
+	return hex.EncodeToString(b[:])
+}
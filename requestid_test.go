@@ -0,0 +1,74 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterRequestID(t *testing.T) {
+	router := New()
+	router.RequestID.Enabled = true
+
+	var got string
+	router.GET("/", func(_ http.ResponseWriter, req *http.Request, _ map[string]string) {
+		got = RequestIDFromContext(req.Context())
+	})
+
+	// An incoming ID is reused.
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "abc")
+	router.ServeHTTP(w, req)
+	if got != "abc" {
+		t.Errorf("wrong request ID: want %q, got %q", "abc", got)
+	}
+	if h := w.Header().Get("X-Request-ID"); h != "abc" {
+		t.Errorf("wrong response header: want %q, got %q", "abc", h)
+	}
+
+	// Otherwise a new ID is generated for each request.
+	var ids []string
+	for i := 0; i < 2; i++ {
+		got = ""
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/", nil)
+		router.ServeHTTP(w, req)
+		if len(got) != 32 {
+			t.Errorf("wrong generated request ID: %q", got)
+		}
+		if h := w.Header().Get("X-Request-ID"); h != got {
+			t.Errorf("wrong response header: want %q, got %q", got, h)
+		}
+		ids = append(ids, got)
+	}
+	if ids[0] == ids[1] {
+		t.Errorf("generated request ID %q twice", ids[0])
+	}
+
+	// The header and the generator are configurable. The ID is also set for
+	// requests without a matching route.
+	router.RequestID.Header = "Trace-Id"
+	router.RequestID.Generate = func() string { return "gen" }
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/missing", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound || w.Header().Get("Trace-Id") != "gen" {
+		t.Errorf("want 404 with Trace-Id %q, got %d with %q", "gen", w.Code, w.Header().Get("Trace-Id"))
+	}
+
+	// Request IDs are disabled by default.
+	router = New()
+	router.GET("/", func(_ http.ResponseWriter, req *http.Request, _ map[string]string) {
+		got = RequestIDFromContext(req.Context())
+	})
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/", nil)
+	router.ServeHTTP(w, req)
+	if got != "" || w.Header().Get("X-Request-ID") != "" {
+		t.Errorf("request ID set although disabled: %q", got)
+	}
+}
@@ -0,0 +1,598 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Route is a handle registered for a method and path, together with its
+// per-route options.
+// A Route is returned by the registration functions of the Router, which
+// allows the options to be chained, e.g.:
+//
+//	router.GET("/search", Search).RateLimit(limiter)
+type Route struct {
+	// Method and Path the route was registered with.
+	Method string
+	Path   string
+
+	// Handle is the registered request handle.
+	Handle Handle
+
+	// The handle registered with HandleNext, if any. Handle wraps it.
+	nextHandle NextHandle
+
+	// The router the route is registered with and the shortest path it is
+	// registered for, which differs from Path if trailing wildcards have
+	// defaults.
+	router    *Router
+	shortPath string
+
+	rateLimit func(http.ResponseWriter, *http.Request) bool
+	defaults  map[string]string
+	consumes  []string
+
+	// The predicate set with When and the next candidate route registered
+	// for the same method and path.
+	when func(*http.Request) bool
+	alt  *Route
+
+	middleware []scopedMiddleware
+
+	// Whether the response is compressed with gzip, and the minimum size of
+	// compressed responses.
+	gzip        bool
+	gzipMinSize int
+
+	// The options set with MaxBodySize and RequireBody.
+	maxBodySize int64
+	requireBody bool
+
+	tags []string
+
+	// The Cache-Control header set with CacheControl.
+	cacheControl string
+
+	// Whether empty responses are answered with "204 No Content".
+	noContent bool
+
+	// The timeout set with Timeout, -1 if it is disabled.
+	timeout time.Duration
+
+	// The priority set with MatchPriority.
+	matchPriority int
+
+	// Whether requests are redirected to the canonical path of the route.
+	canonical bool
+
+	// Whether the catch-all of the route matches an empty value even if
+	// CatchAllRequiresSegment is enabled, see Router.Proxy.
+	matchesEmpty bool
+
+	// The aliases set with Alias, mapped to the names of their wildcards.
+	aliases map[string]string
+
+	// The validators added with Validate.
+	validators []func(*http.Request) error
+
+	// The handler set with OtherMethods.
+	otherMethods http.Handler
+
+	// The panic handler set with Recover.
+	panicHandler func(http.ResponseWriter, *http.Request, interface{})
+}
+
+// Tag attaches tags to the route, e.g. to group routes for documentation or
+// to apply policies to them. The routes with a tag are returned by
+// Router.RoutesByTag.
+func (rt *Route) Tag(tags ...string) *Route {
+	for _, tag := range tags {
+		if !rt.HasTag(tag) {
+			rt.tags = append(rt.tags, tag)
+		}
+	}
+	return rt
+}
+
+// Tags returns the tags of the route in the order they were attached.
+func (rt *Route) Tags() []string {
+	return append([]string(nil), rt.tags...)
+}
+
+// HasTag reports whether the route has the tag.
+func (rt *Route) HasTag(tag string) bool {
+	for _, t := range rt.tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// OtherMethods sets a handler for the requests whose path the route matches,
+// but whose method has no route for the path, e.g. to delegate them to a
+// proxy instead of answering them with "405 Method Not Allowed":
+//
+//	router.GET("/api/*path", CachedAPI).OtherMethods(proxy)
+//
+// The values of the wildcards of the route are stored in the request context
+// and can be retrieved with VarsFromContext.
+// OtherMethods panics if the path of the route has no catch-all wildcard.
+func (rt *Route) OtherMethods(handler http.Handler) *Route {
+	if !strings.Contains(rt.Path, "*") {
+		panic("OtherMethods requires a catch-all route, but path '" + rt.Path + "' has none")
+	}
+	rt.otherMethods = handler
+	if rt.router != nil {
+		rt.router.otherMethods = true
+	}
+	return rt
+}
+
+// Recover sets a handler for panics of the handle of the route, which is
+// used instead of the PanicHandler and PanicHandlerWithContext of the router,
+// e.g. to render a cached response if the handle fails. Panics of other
+// routes and outside of handles are still handled by the router.
+func (rt *Route) Recover(handler func(w http.ResponseWriter, r *http.Request, recovered interface{})) *Route {
+	rt.panicHandler = handler
+	return rt
+}
+
+// RateLimit sets a hook which is consulted before the handle is invoked.
+// If the hook returns false, the request is answered with
+// "429 Too Many Requests" and the handle is not invoked.
+// The limiter itself is supplied by the user, e.g. a token bucket per client.
+func (rt *Route) RateLimit(limiter func(w http.ResponseWriter, r *http.Request) (allow bool)) *Route {
+	rt.rateLimit = limiter
+	return rt
+}
+
+// Gzip compresses the responses of the route with gzip for clients which
+// accept it. Responses with a Content-Encoding set by the handle and
+// responses of compressed content types, e.g. images, are not compressed.
+func (rt *Route) Gzip() *Route {
+	rt.gzip = true
+	return rt
+}
+
+// GzipMinSize is like Gzip, but responses shorter than size bytes are not
+// compressed. The response is buffered until it reaches the size.
+func (rt *Route) GzipMinSize(size int) *Route {
+	rt.gzip = true
+	rt.gzipMinSize = size
+	return rt
+}
+
+// CacheControl sets the Cache-Control header of the responses of the route to
+// the directives, e.g. "public, max-age=300". The header is set before the
+// handle is invoked, thus the handle can still override or remove it.
+// Requests rejected by the router, e.g. because of RateLimit, don't get it.
+func (rt *Route) CacheControl(directives string) *Route {
+	rt.cacheControl = directives
+	return rt
+}
+
+// NoContent answers requests with "204 No Content" if the handle neither
+// writes a body nor sets a status code, e.g. for DELETE routes, instead of
+// the "200 OK" the http.Server would send.
+func (rt *Route) NoContent() *Route {
+	rt.noContent = true
+	return rt
+}
+
+// noContentWriter records whether the handle wrote to the response.
+type noContentWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *noContentWriter) WriteHeader(code int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *noContentWriter) Write(p []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush flushes the response to the client, which writes the header.
+func (w *noContentWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.written = true
+		f.Flush()
+	}
+}
+
+// MaxBodySize limits the size of request bodies to n bytes. Requests whose
+// Content-Length exceeds the limit are answered with "413 Payload Too Large"
+// and the handle is not invoked. Otherwise the body is limited with
+// http.MaxBytesReader, thus reading a streamed body beyond the limit fails
+// with an *http.MaxBytesError.
+func (rt *Route) MaxBodySize(n int64) *Route {
+	rt.maxBodySize = n
+	return rt
+}
+
+// RequireBody rejects requests without a body before the handle is invoked.
+// Requests without a Content-Length which aren't streamed are answered with
+// "411 Length Required", requests with a Content-Length of 0 with
+// "400 Bad Request".
+func (rt *Route) RequireBody() *Route {
+	rt.requireBody = true
+	return rt
+}
+
+// checkBody checks the body of the request against the options of the route.
+// It returns the http status code to reject the request with, or 0.
+func (rt *Route) checkBody(req *http.Request) int {
+	if rt.requireBody && req.ContentLength == 0 {
+		if req.Header.Get("Content-Length") == "" {
+			return http.StatusLengthRequired
+		}
+		return http.StatusBadRequest
+	}
+	if rt.maxBodySize > 0 && req.ContentLength > rt.maxBodySize {
+		return http.StatusRequestEntityTooLarge
+	}
+	return 0
+}
+
+// StatusError is an error with the http status code to answer a request
+// with, e.g. returned by a validator of a route (see Route.Validate).
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+func (e *StatusError) Error() string {
+	if e.Err == nil {
+		return http.StatusText(e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// Validate adds a validator which checks requests before the handle is
+// invoked, e.g. whether a required header is set. If the validator returns
+// an error, the request is answered with "400 Bad Request", or with the
+// status code of a *StatusError in the error chain, and neither further
+// validators nor the handle are invoked. Validators run in the order they
+// are added:
+//
+//	router.POST("/orders", CreateOrder).Validate(func(r *http.Request) error {
+//		if r.Header.Get("Idempotency-Key") == "" {
+//			return errors.New("missing Idempotency-Key")
+//		}
+//		return nil
+//	})
+func (rt *Route) Validate(validator func(r *http.Request) error) *Route {
+	rt.validators = append(rt.validators, validator)
+	return rt
+}
+
+// validate runs the validators of the route. It returns the http status code
+// to reject the request with, or 0.
+func (rt *Route) validate(req *http.Request) int {
+	for _, validator := range rt.validators {
+		if err := validator(req); err != nil {
+			var se *StatusError
+			if errors.As(err, &se) && se.Code != 0 {
+				return se.Code
+			}
+			return http.StatusBadRequest
+		}
+	}
+	return 0
+}
+
+// Consumes restricts the route to requests whose Content-Type is one of the
+// given media types. Requests with another or without a Content-Type are
+// answered with "415 Unsupported Media Type" and the handle is not invoked.
+// Parameters of the Content-Type, like the charset, are ignored. A media type
+// may be a wildcard, e.g. "text/*" or "*/*":
+//
+//	router.POST("/users", CreateUser).Consumes("application/json")
+func (rt *Route) Consumes(mediaTypes ...string) *Route {
+	rt.consumes = append(rt.consumes, mediaTypes...)
+	return rt
+}
+
+// consumesContentType reports whether the route accepts a request with the
+// given Content-Type.
+func (rt *Route) consumesContentType(contentType string) bool {
+	if len(rt.consumes) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, accepted := range rt.consumes {
+		accepted = strings.ToLower(accepted)
+		switch {
+		case accepted == "*/*", accepted == mediaType:
+			return true
+		case strings.HasSuffix(accepted, "/*"):
+			if strings.HasPrefix(mediaType, accepted[:len(accepted)-1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// When sets a predicate which is evaluated for each request matching the
+// route. If it returns false, the route is skipped and the request is
+// dispatched to the next candidate, or to the NotFound handler if there is
+// none.
+//
+// Further routes can be registered for the same method and path as long as
+// all previously registered routes for it have a predicate or are registered
+// with HandleNext. The candidates are considered in the order they were
+// registered, e.g.:
+//
+//	router.GET("/x", Canary).When(isCanary)
+//	router.GET("/x", Stable)
+func (rt *Route) When(predicate func(r *http.Request) bool) *Route {
+	rt.when = predicate
+	return rt
+}
+
+// Header restricts the route to requests with the given header. If value is
+// empty, the header must merely be present, otherwise one of its values must
+// equal value. Like the predicate set with When, header constraints select
+// among several routes registered for the same method and path, e.g.:
+//
+//	router.GET("/users", UsersV2).Header("Accept-Version", "2")
+//	router.GET("/users", Users)
+//
+// Header may be called several times, all constraints must then be satisfied.
+// A predicate set with When before Header is kept, whereas When called after
+// Header replaces the header constraints.
+func (rt *Route) Header(key, value string) *Route {
+	key = http.CanonicalHeaderKey(key)
+	prev := rt.when
+	return rt.When(func(r *http.Request) bool {
+		if prev != nil && !prev(r) {
+			return false
+		}
+		values := r.Header[key]
+		if value == "" {
+			return len(values) > 0
+		}
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// AjaxOnly restricts the route to AJAX requests, i.e. requests with the
+// header "X-Requested-With: XMLHttpRequest" set by JavaScript libraries. Like
+// Header, it allows to register another route for full-page requests to the
+// same method and path after it, e.g.:
+//
+//	router.GET("/cart", CartJSON).AjaxOnly()
+//	router.GET("/cart", CartPage)
+func (rt *Route) AjaxOnly() *Route {
+	return rt.Header("X-Requested-With", "XMLHttpRequest")
+}
+
+// ServerName restricts the route to TLS requests whose SNI server name is
+// name, compared case-insensitively. Unlike the Host header, the server name
+// is the one the client requested the TLS connection for. Requests without
+// TLS don't satisfy the constraint. Like Header, it combines with a predicate
+// set with When before, e.g.:
+//
+//	router.GET("/", TenantA).ServerName("a.example.com")
+//	router.GET("/", TenantB).ServerName("b.example.com")
+func (rt *Route) ServerName(name string) *Route {
+	prev := rt.when
+	return rt.When(func(r *http.Request) bool {
+		if prev != nil && !prev(r) {
+			return false
+		}
+		return r.TLS != nil && strings.EqualFold(r.TLS.ServerName, name)
+	})
+}
+
+// addCandidate appends route to the candidates registered for the same method
+// and path as rt. It reports false if the last candidate handles all requests,
+// since route could then never be reached.
+func (rt *Route) addCandidate(route *Route) bool {
+	last := rt
+	for last.alt != nil {
+		last = last.alt
+	}
+	if last.when == nil && last.nextHandle == nil {
+		return false
+	}
+	last.alt = route
+	return true
+}
+
+// Canonical makes the route redirect requests to its canonical path, so that
+// its content is only served at one URL. The canonical path of a request is
+// its path cleaned with CleanPath, with the static parts lowercased and the
+// trailing slash of the route. The values of wildcards keep their case.
+// Requests whose path differs from the canonical path are permanently
+// redirected to it, even if their path matches the route as is, e.g. /Foo,
+// /foo/ and /a/../foo are redirected to /foo for a route /foo, and
+// /Users/Alice to /users/Alice for a route /users/:name.
+// The path of the route must be lowercase itself. Routes matching the
+// request path as it is, e.g. a route /Foo, take precedence.
+// GET and HEAD requests are redirected with http status code 301, all other
+// requests with 308.
+func (rt *Route) Canonical() *Route {
+	rt.canonical = true
+	if rt.router != nil {
+		rt.router.canonicalRoutes = true
+	}
+	return rt
+}
+
+// BothSlashes registers the route also for its path with the trailing slash
+// added or removed, so that both variants are served directly instead of the
+// one being redirected to the other, e.g. /users and /users/.
+// Routes ending with a catch-all already match both variants. The variant
+// with the trailing slash isn't registered if a catch-all route follows it,
+// e.g. /files/ for /files/*filepath, since the catch-all matches it.
+func (rt *Route) BothSlashes() *Route {
+	path := rt.Path
+	if rt.router == nil || path == "/" || strings.Contains(path, "*") {
+		return rt
+	}
+
+	path = toggleTrailingSlash(path)
+	rt.router.compileFor(path)
+	if n := rt.router.findPattern(path); n != nil && n.catchAllChild != nil {
+		return rt
+	}
+	rt.router.register(rt.Method, path, rt)
+	return rt
+}
+
+// Default sets a default value for the wildcard with the given name, which
+// is used if the wildcard is not part of the matched request path.
+//
+// If the wildcard is the last element of the path, the route is also
+// registered for the path without it. For example, a route for "/list/:page"
+// with a default "1" for "page" also matches "/list" with vars["page"] = "1".
+// Defaults of several trailing wildcards must be set from the last to the
+// first one.
+//
+// A value captured from the request path always takes precedence over the
+// default. Since parameters never match an empty segment, a request for
+// "/list/" doesn't match "/list/:page" but is redirected to "/list" (if
+// RedirectTrailingSlash is enabled), where the default applies.
+func (rt *Route) Default(name, value string) *Route {
+	if rt.defaults == nil {
+		rt.defaults = make(map[string]string)
+	}
+	rt.defaults[name] = value
+
+	if rt.router == nil {
+		return rt
+	}
+
+	path := rt.shortPath
+	if path == "" {
+		path = rt.Path
+	}
+	for _, wildcard := range [...]string{"/:" + name, "/*" + name} {
+		if strings.HasSuffix(path, wildcard) {
+			path = path[:len(path)-len(wildcard)]
+			if path == "" {
+				path = "/"
+			}
+			rt.shortPath = path
+			rt.router.register(rt.Method, path, rt)
+			break
+		}
+	}
+	return rt
+}
+
+// Alias makes the value of the wildcard with the given name also available
+// under the alias in the vars of the route, e.g. to keep handles reading
+// vars["id"] working after renaming the wildcard ":id" to ":userID":
+//
+//	router.GET("/users/:userID", GetUser).Alias("userID", "id")
+//
+// Alias panics if the path of the route has no wildcard with the name.
+func (rt *Route) Alias(name, alias string) *Route {
+	wildcards, _ := ParseWildcards(rt.Path)
+	found := false
+	for _, wildcard := range wildcards {
+		found = found || wildcard.Name == name
+	}
+	if !found {
+		panic("no wildcard '" + name + "' to alias in path '" + rt.Path + "'")
+	}
+
+	if rt.aliases == nil {
+		rt.aliases = make(map[string]string)
+	}
+	rt.aliases[alias] = name
+	return rt
+}
+
+// applyDefaults adds the defaults of the route to vars, if they are not
+// already set, and the values of the wildcards with aliases under their
+// aliases.
+func (rt *Route) applyDefaults(vars map[string]string) map[string]string {
+	if len(rt.defaults) == 0 && len(rt.aliases) == 0 {
+		return vars
+	}
+	if vars == nil {
+		vars = make(map[string]string, len(rt.defaults))
+	}
+	for name, value := range rt.defaults {
+		if _, ok := vars[name]; !ok {
+			vars[name] = value
+		}
+	}
+	for alias, name := range rt.aliases {
+		if value, ok := vars[name]; ok {
+			vars[alias] = value
+		}
+	}
+	return vars
+}
+
+// MatchPriority sets the priority of the route when several routes match a
+// request path, e.g. a parameter and a CatchAll following the same path. By
+// default the most specific route wins, in the order static path elements,
+// parameters, CatchAll wildcards, and a deeper CatchAll before the ones of its
+// parent paths. The route with the highest match priority is preferred
+// instead, routes with the same priority are still ordered by specificity.
+// The default priority is 0.
+//
+// Candidates registered for the same method and path with When share the
+// highest priority among them.
+func (rt *Route) MatchPriority(prio int) *Route {
+	rt.matchPriority = prio
+	if rt.router != nil {
+		rt.router.matchPriorities = true
+	}
+	return rt
+}
+
+// maxMatchPriority returns the highest match priority among rt and the
+// candidates registered for the same method and path after it.
+func (rt *Route) maxMatchPriority() int {
+	prio := rt.matchPriority
+	for alt := rt.alt; alt != nil; alt = alt.alt {
+		if alt.matchPriority > prio {
+			prio = alt.matchPriority
+		}
+	}
+	return prio
+}
+
+// Priority sets the priority of the tree node holding the route, which
+// replaces the priority computed from the number of handles registered below
+// the node. Sibling nodes are considered in the order of their priority when
+// matching requests, thus a node with a higher priority is considered first.
+// Routes registered below the node later on further bump the priority,
+// starting from the explicit priority.
+func (rt *Route) Priority(prio uint32) *Route {
+	if rt.router != nil {
+		rt.router.compileFor(rt.Path)
+		rt.router.setPriority(rt.Path, prio)
+	}
+	return rt
+}
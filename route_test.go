@@ -0,0 +1,823 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRouteDefault(t *testing.T) {
+	router := New()
+
+	var got map[string]string
+	handle := func(_ http.ResponseWriter, _ *http.Request, vars map[string]string) {
+		got = vars
+	}
+	router.GET("/list/:page", handle).Default("page", "1")
+	router.GET("/items/:sort/:size", handle).Default("size", "10").Default("sort", "name")
+	router.GET("/lang/:lang", handle).Default("lang", "en")
+	router.GET("/user/:id/posts", handle).Default("id", "me")
+
+	tests := []struct {
+		path string
+		vars map[string]string
+	}{
+		{"/list", map[string]string{"page": "1"}},
+		{"/list/3", map[string]string{"page": "3"}},
+		{"/items", map[string]string{"sort": "name", "size": "10"}},
+		{"/items/date", map[string]string{"sort": "date", "size": "10"}},
+		{"/items/date/5", map[string]string{"sort": "date", "size": "5"}},
+		{"/lang", map[string]string{"lang": "en"}},
+		{"/lang/de", map[string]string{"lang": "de"}},
+		{"/user/5/posts", map[string]string{"id": "5"}},
+	}
+
+	for _, test := range tests {
+		got = nil
+		w := new(mockResponseWriter)
+		req, _ := http.NewRequest("GET", test.path, nil)
+		router.ServeHTTP(w, req)
+		if !reflect.DeepEqual(got, test.vars) {
+			t.Errorf("wrong vars for path '%s': want %v, got %v", test.path, test.vars, got)
+		}
+	}
+
+	if route, _, tsr := router.getValue("GET", "/list/"); route != nil || !tsr {
+		t.Errorf("expected TSR recommendation for '/list/'")
+	}
+
+	root := New()
+	root.GET("/:lang", handle).Default("lang", "en")
+	if _, vars, _ := root.getValue("GET", "/"); vars["lang"] != "en" {
+		t.Errorf("wrong vars for path '/': want lang=en, got %v", vars)
+	}
+}
+
+func TestRoutePriority(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.GET("/", handle)
+	router.GET("/a/1", handle)
+	router.GET("/a/2", handle)
+	router.GET("/a/3", handle)
+	router.GET("/b/1", handle)
+	router.GET("/b/2", handle)
+	low := router.GET("/c", handle)
+	high := router.GET("/d", handle)
+
+	if indices := string(router.indices); indices != "abcd" {
+		t.Fatalf("wrong order of children: want %q, got %q", "abcd", indices)
+	}
+
+	high.Priority(10)
+	if indices := string(router.indices); indices != "dabc" {
+		t.Errorf("wrong order of children after raising priority: want %q, got %q", "dabc", indices)
+	}
+
+	router.Handle("GET", "/a/4", handle)
+	router.Handle("GET", "/a/5", handle)
+	if indices := string(router.indices); indices != "dabc" {
+		t.Errorf("wrong order of children after bumping priority: want %q, got %q", "dabc", indices)
+	}
+
+	router.GET("/d/1", handle)
+	if prio := router.children[0].priority; prio != 11 {
+		t.Errorf("wrong bumped priority: want 11, got %d", prio)
+	}
+
+	high.Priority(0)
+	low.Priority(3)
+	if indices := string(router.indices); indices != "acbd" {
+		t.Errorf("wrong order of children after lowering priority: want %q, got %q", "acbd", indices)
+	}
+
+	for _, path := range []string{"/", "/a/1", "/b/2", "/c", "/d", "/d/1"} {
+		if route, _, _ := router.getValue("GET", path); route == nil {
+			t.Errorf("no route for path '%s'", path)
+		}
+	}
+}
+
+func TestRouteAlias(t *testing.T) {
+	router := New()
+
+	var got map[string]string
+	handle := func(_ http.ResponseWriter, _ *http.Request, vars map[string]string) {
+		got = vars
+	}
+	router.GET("/users/:userID", handle).Alias("userID", "id").Alias("userID", "uid")
+	router.GET("/files/:dir/*filepath", handle).Alias("filepath", "path")
+	router.GET("/list/:page", handle).Default("page", "1").Alias("page", "p")
+
+	tests := []struct {
+		path string
+		vars map[string]string
+	}{
+		{"/users/42", map[string]string{"userID": "42", "id": "42", "uid": "42"}},
+		{"/files/a/b.txt", map[string]string{"dir": "a", "filepath": "/b.txt", "path": "/b.txt"}},
+		{"/list/3", map[string]string{"page": "3", "p": "3"}},
+		{"/list", map[string]string{"page": "1", "p": "1"}},
+	}
+	for _, test := range tests {
+		got = nil
+		req, _ := http.NewRequest("GET", test.path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		if !reflect.DeepEqual(got, test.vars) {
+			t.Errorf("%s: want vars %v, got %v", test.path, test.vars, got)
+		}
+	}
+
+	recv := catchPanic(func() {
+		router.GET("/posts/:id", handle).Alias("postID", "id")
+	})
+	if recv == nil {
+		t.Error("no panic for an alias of an unknown wildcard")
+	}
+}
+
+func TestRouteMatchPriority(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.GET("/files/:name", handle)
+	router.GET("/files/:name/raw", handle)
+	files := router.GET("/files/*filepath", handle)
+	src := router.GET("/src/*filepath", handle)
+	vendor := router.GET("/src/vendor/*pkg", handle)
+	main := router.GET("/src/main.go", handle)
+
+	tests := []struct {
+		path    string
+		pattern string
+	}{
+		{"/files/readme", "/files/:name"},
+		{"/files/readme/raw", "/files/:name/raw"},
+		{"/files/a/b", "/files/*filepath"},
+		{"/src/vendor/x", "/src/vendor/*pkg"},
+		{"/src/main.go", "/src/main.go"},
+		{"/src/lib.go", "/src/*filepath"},
+	}
+	check := func(when string) {
+		t.Helper()
+		for _, test := range tests {
+			route, _, _ := router.getValue("GET", test.path)
+			if route == nil {
+				t.Errorf("%s: no route for path '%s'", when, test.path)
+			} else if route.Path != test.pattern {
+				t.Errorf("%s: wrong route for path '%s': want %q, got %q", when, test.path, test.pattern, route.Path)
+			}
+		}
+	}
+	check("default")
+
+	// Raise the catch-alls above the routes they overlap with.
+	files.MatchPriority(1)
+	src.MatchPriority(2)
+	main.MatchPriority(1)
+	tests = []struct {
+		path    string
+		pattern string
+	}{
+		{"/files/readme", "/files/*filepath"},
+		{"/files/readme/raw", "/files/*filepath"},
+		{"/src/vendor/x", "/src/*filepath"},
+		{"/src/main.go", "/src/*filepath"},
+		{"/src/lib.go", "/src/*filepath"},
+	}
+	check("raised")
+
+	// Among several catch-alls, the higher priority wins, equal priorities
+	// fall back to the most specific route.
+	vendor.MatchPriority(3)
+	main.MatchPriority(2)
+	tests = []struct {
+		path    string
+		pattern string
+	}{
+		{"/src/vendor/x", "/src/vendor/*pkg"},
+		{"/src/main.go", "/src/main.go"},
+	}
+	check("overridden")
+
+	if _, vars, _ := router.getValue("GET", "/files/readme"); vars["filepath"] != "/readme" || len(vars) != 1 {
+		t.Errorf("wrong vars for the catch-all: want filepath=/readme, got %v", vars)
+	}
+}
+
+func TestRouteValidate(t *testing.T) {
+	router := New()
+
+	var calls []string
+	validator := func(name string, err error) func(*http.Request) error {
+		return func(*http.Request) error {
+			calls = append(calls, name)
+			return err
+		}
+	}
+	requireKey := func(r *http.Request) error {
+		calls = append(calls, "key")
+		if r.Header.Get("Idempotency-Key") == "" {
+			return errors.New("missing Idempotency-Key")
+		}
+		return nil
+	}
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		calls = append(calls, "handle")
+	}
+	router.POST("/orders", handle).Validate(validator("first", nil)).Validate(requireKey)
+	router.POST("/locked", handle).
+		Validate(validator("lock", fmt.Errorf("locked: %w", &StatusError{Code: http.StatusLocked}))).
+		Validate(validator("never", nil))
+
+	tests := []struct {
+		path  string
+		key   string
+		code  int
+		calls []string
+	}{
+		{"/orders", "abc", http.StatusOK, []string{"first", "key", "handle"}},
+		{"/orders", "", http.StatusBadRequest, []string{"first", "key"}},
+		{"/locked", "abc", http.StatusLocked, []string{"lock"}},
+	}
+	for _, test := range tests {
+		calls = nil
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", test.path, nil)
+		if test.key != "" {
+			req.Header.Set("Idempotency-Key", test.key)
+		}
+		router.ServeHTTP(w, req)
+		if w.Code != test.code || !reflect.DeepEqual(calls, test.calls) {
+			t.Errorf("%s with key %q: want %d %v, got %d %v", test.path, test.key, test.code, test.calls, w.Code, calls)
+		}
+	}
+
+	if err := (&StatusError{Code: http.StatusLocked}); err.Error() != "Locked" {
+		t.Errorf("wrong message of StatusError without error: %q", err.Error())
+	}
+}
+
+func TestRouteConsumes(t *testing.T) {
+	router := New()
+
+	routed := false
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		routed = true
+	}
+	router.POST("/json", handle).Consumes("application/json")
+	router.POST("/multi", handle).Consumes("application/json", "text/*")
+	router.POST("/any", handle).Consumes("*/*")
+
+	tests := []struct {
+		path        string
+		contentType string
+		code        int
+	}{
+		{"/json", "application/json", http.StatusOK},
+		{"/json", "application/json; charset=utf-8", http.StatusOK},
+		{"/json", "Application/JSON", http.StatusOK},
+		{"/json", "text/plain", http.StatusUnsupportedMediaType},
+		{"/json", "", http.StatusUnsupportedMediaType},
+		{"/multi", "application/json", http.StatusOK},
+		{"/multi", "text/csv", http.StatusOK},
+		{"/multi", "textual/csv", http.StatusUnsupportedMediaType},
+		{"/multi", "application/xml", http.StatusUnsupportedMediaType},
+		{"/any", "image/png", http.StatusOK},
+		{"/any", "", http.StatusUnsupportedMediaType},
+	}
+
+	for _, test := range tests {
+		routed = false
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", test.path, nil)
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		router.ServeHTTP(w, req)
+		if w.Code != test.code || routed != (test.code == http.StatusOK) {
+			t.Errorf("%s with Content-Type %q: want code %d, got %d (routed=%t)",
+				test.path, test.contentType, test.code, w.Code, routed)
+		}
+	}
+}
+
+func TestRouteWhen(t *testing.T) {
+	router := New()
+
+	canary := false
+	var got string
+	handleFor := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+			got = name
+		}
+	}
+	isCanary := func(_ *http.Request) bool {
+		return canary
+	}
+	router.GET("/x", handleFor("canary")).When(isCanary)
+	router.GET("/x", handleFor("stable"))
+	router.GET("/y", handleFor("canary")).When(isCanary)
+	router.HandleNext("GET", "/z", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string, next func()) {
+		next()
+	})
+	router.GET("/z", handleFor("fallback"))
+
+	notFound := false
+	router.NotFound = func(_ http.ResponseWriter, _ *http.Request) {
+		notFound = true
+	}
+
+	tests := []struct {
+		path   string
+		canary bool
+		name   string
+	}{
+		{"/x", false, "stable"},
+		{"/x", true, "canary"},
+		{"/y", true, "canary"},
+		{"/y", false, ""},
+		{"/z", false, "fallback"},
+	}
+
+	for _, test := range tests {
+		canary = test.canary
+		got, notFound = "", false
+		w := new(mockResponseWriter)
+		req, _ := http.NewRequest("GET", test.path, nil)
+		router.ServeHTTP(w, req)
+		if got != test.name || notFound != (test.name == "") {
+			t.Errorf("%s (canary=%t): want %q, got %q (notFound=%t)", test.path, test.canary, test.name, got, notFound)
+		}
+	}
+
+	// A route registered after a route without a predicate is unreachable.
+	recv := catchPanic(func() {
+		router.GET("/x", handleFor("unreachable"))
+	})
+	if recv == nil {
+		t.Error("no panic while registering a route after an unconditional route")
+	}
+}
+
+func TestRouteHeader(t *testing.T) {
+	router := New()
+
+	var got string
+	handleFor := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+			got = name
+		}
+	}
+	router.GET("/users", handleFor("v2")).Header("Accept-Version", "2")
+	router.GET("/users", handleFor("beta")).Header("x-beta", "")
+	router.GET("/users", handleFor("v1"))
+	router.GET("/only", handleFor("v2")).Header("Accept-Version", "2")
+
+	tests := []struct {
+		path    string
+		headers map[string]string
+		name    string
+	}{
+		{"/users", map[string]string{"Accept-Version": "2"}, "v2"},
+		{"/users", map[string]string{"Accept-Version": "3"}, "v1"},
+		{"/users", nil, "v1"},
+		{"/users", map[string]string{"X-Beta": ""}, "beta"},
+		{"/only", map[string]string{"Accept-Version": "2"}, "v2"},
+		{"/only", map[string]string{"Accept-Version": "1"}, ""},
+		{"/only", nil, ""},
+	}
+
+	for _, test := range tests {
+		got = ""
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", test.path, nil)
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+		router.ServeHTTP(w, req)
+		if got != test.name {
+			t.Errorf("%s %v: want %q, got %q", test.path, test.headers, test.name, got)
+		}
+		if test.name == "" && w.Code != http.StatusNotFound {
+			t.Errorf("%s %v: want status 404, got %d", test.path, test.headers, w.Code)
+		}
+	}
+}
+
+func TestRouteBothSlashes(t *testing.T) {
+	var got string
+	handleFor := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+			got = name
+		}
+	}
+
+	router := New()
+	router.GET("/users", handleFor("users")).BothSlashes()
+	router.GET("/dir/", handleFor("dir")).BothSlashes()
+	router.GET("/user/:id", handleFor("user")).BothSlashes()
+	router.GET("/files/*filepath", handleFor("files"))
+	router.GET("/files", handleFor("root")).BothSlashes()
+	router.GET("/src/*filepath", handleFor("src")).BothSlashes()
+	router.GET("/", handleFor("index")).BothSlashes()
+
+	tests := []struct {
+		path string
+		name string
+	}{
+		{"/users", "users"},
+		{"/users/", "users"},
+		{"/dir", "dir"},
+		{"/dir/", "dir"},
+		{"/user/42", "user"},
+		{"/user/42/", "user"},
+		{"/files", "root"},
+		{"/files/", "files"},
+		{"/src/", "src"},
+		{"/", "index"},
+	}
+
+	for _, test := range tests {
+		got = ""
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", test.path, nil)
+		router.ServeHTTP(w, req)
+		if got != test.name || w.Code != http.StatusOK {
+			t.Errorf("%s: want %q with status 200, got %q with status %d", test.path, test.name, got, w.Code)
+		}
+	}
+
+	// A variant conflicting with another route panics like any registration.
+	router.GET("/a/", handleFor("a"))
+	if recv := catchPanic(func() { router.GET("/a", handleFor("a")).BothSlashes() }); recv == nil {
+		t.Error("no panic for variant conflicting with an existing route")
+	}
+}
+
+func TestRouteBody(t *testing.T) {
+	var readErr error
+	routed := false
+	handle := func(_ http.ResponseWriter, req *http.Request, _ map[string]string) {
+		routed = true
+		_, readErr = io.ReadAll(req.Body)
+	}
+
+	router := New()
+	router.POST("/upload", handle).RequireBody().MaxBodySize(8)
+	router.POST("/limited", handle).MaxBodySize(8)
+
+	// streamed hides the length of the body, like a chunked request.
+	streamed := func(s string) io.Reader {
+		return io.MultiReader(strings.NewReader(s))
+	}
+	tests := []struct {
+		path    string
+		body    io.Reader
+		length  string
+		code    int
+		readErr bool
+	}{
+		{"/upload", nil, "", http.StatusLengthRequired, false},
+		{"/upload", strings.NewReader(""), "0", http.StatusBadRequest, false},
+		{"/upload", strings.NewReader("0123456789"), "", http.StatusRequestEntityTooLarge, false},
+		{"/upload", streamed("0123456789"), "", http.StatusOK, true},
+		{"/upload", strings.NewReader("01234567"), "", http.StatusOK, false},
+		{"/upload", streamed("0123"), "", http.StatusOK, false},
+		{"/limited", nil, "", http.StatusOK, false},
+		{"/limited", strings.NewReader("0123456789"), "", http.StatusRequestEntityTooLarge, false},
+	}
+
+	for i, test := range tests {
+		routed, readErr = false, nil
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", test.path, test.body)
+		if test.length != "" {
+			req.Header.Set("Content-Length", test.length)
+		}
+		router.ServeHTTP(w, req)
+		if w.Code != test.code || routed != (test.code == http.StatusOK) {
+			t.Errorf("#%d %s: want status %d, got %d (routed=%t)", i, test.path, test.code, w.Code, routed)
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(readErr, &maxBytesErr) != test.readErr {
+			t.Errorf("#%d %s: want read error=%t, got %v", i, test.path, test.readErr, readErr)
+		}
+	}
+}
+
+func TestRouteAjaxOnly(t *testing.T) {
+	router := New()
+
+	var got string
+	handleFor := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+			got = name
+		}
+	}
+	router.GET("/cart", handleFor("ajax")).AjaxOnly()
+	router.GET("/cart", handleFor("page"))
+	router.POST("/cart/items", handleFor("ajax")).AjaxOnly()
+
+	tests := []struct {
+		method, path  string
+		requestedWith string
+		name          string
+	}{
+		{"GET", "/cart", "XMLHttpRequest", "ajax"},
+		{"GET", "/cart", "", "page"},
+		{"GET", "/cart", "com.example.app", "page"},
+		{"POST", "/cart/items", "XMLHttpRequest", "ajax"},
+		{"POST", "/cart/items", "", ""},
+	}
+
+	for _, test := range tests {
+		got = ""
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(test.method, test.path, nil)
+		if test.requestedWith != "" {
+			req.Header.Set("X-Requested-With", test.requestedWith)
+		}
+		router.ServeHTTP(w, req)
+		if got != test.name {
+			t.Errorf("%s %s with X-Requested-With %q: want %q, got %q", test.method, test.path, test.requestedWith, test.name, got)
+		}
+	}
+}
+
+func TestRouteServerName(t *testing.T) {
+	router := New()
+
+	var got string
+	handleFor := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+			got = name
+		}
+	}
+	router.GET("/", handleFor("a")).ServerName("a.example.com")
+	router.GET("/", handleFor("b")).ServerName("b.example.com")
+	router.GET("/", handleFor("default"))
+	router.GET("/only", handleFor("a")).ServerName("a.example.com")
+
+	tests := []struct {
+		path       string
+		serverName string
+		tls        bool
+		name       string
+	}{
+		{"/", "a.example.com", true, "a"},
+		{"/", "B.Example.com", true, "b"},
+		{"/", "c.example.com", true, "default"},
+		{"/", "", false, "default"},
+		{"/only", "a.example.com", true, "a"},
+		{"/only", "b.example.com", true, ""},
+		{"/only", "", false, ""},
+	}
+
+	for _, test := range tests {
+		got = ""
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", test.path, nil)
+		req.Host = "a.example.com"
+		if test.tls {
+			req.TLS = &tls.ConnectionState{ServerName: test.serverName}
+		}
+		router.ServeHTTP(w, req)
+		if got != test.name {
+			t.Errorf("%s with server name %q: want %q, got %q", test.path, test.serverName, test.name, got)
+		}
+	}
+}
+
+func TestRouteCacheControl(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+	override := func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	decline := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string, next func()) {
+		next()
+	}
+
+	router := New()
+	router.GET("/static", handle).CacheControl("public, max-age=300")
+	router.GET("/private", override).CacheControl("public, max-age=300")
+	router.GET("/plain", handle)
+	router.HandleNext("GET", "/declined", decline).CacheControl("public, max-age=300")
+	router.GET("/limited", handle).CacheControl("public, max-age=300").
+		RateLimit(func(http.ResponseWriter, *http.Request) bool { return false })
+
+	tests := []struct {
+		path   string
+		code   int
+		header string
+	}{
+		{"/static", http.StatusOK, "public, max-age=300"},
+		{"/private", http.StatusOK, "no-store"},
+		{"/plain", http.StatusOK, ""},
+		{"/declined", http.StatusNotFound, ""},
+		{"/limited", http.StatusTooManyRequests, ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", test.path, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != test.code {
+			t.Errorf("%s: wrong status: want %d, got %d", test.path, test.code, w.Code)
+		}
+		if got := w.Header().Get("Cache-Control"); got != test.header {
+			t.Errorf("%s: wrong Cache-Control header: want %q, got %q", test.path, test.header, got)
+		}
+	}
+}
+
+func TestRouteCanonical(t *testing.T) {
+	handle := func(w http.ResponseWriter, req *http.Request, _ map[string]string) {
+		io.WriteString(w, req.URL.Path)
+	}
+
+	router := New()
+	router.MergeSlashes = true
+	router.GET("/foo", handle).BothSlashes().Canonical()
+	router.GET("/bar", handle).BothSlashes()
+	router.GET("/users/:name/", handle).Canonical()
+	router.GET("/files/*filepath", handle).Canonical()
+	router.POST("/foo", handle).Canonical()
+	router.GET("/baz", handle).Canonical()
+	router.GET("/Baz", handle)
+	router.GET("/docs/:name.json", handle).Canonical()
+
+	tests := []struct {
+		method   string
+		path     string
+		code     int
+		location string
+	}{
+		{"GET", "/foo", http.StatusOK, ""},
+		{"GET", "/Foo/", http.StatusMovedPermanently, "/foo"},
+		{"GET", "/foo/", http.StatusMovedPermanently, "/foo"},
+		{"GET", "/FOO?x=1", http.StatusMovedPermanently, "/foo?x=1"},
+		{"GET", "/./foo", http.StatusMovedPermanently, "/foo"},
+		{"POST", "/Foo", http.StatusPermanentRedirect, "/foo"},
+		{"GET", "/bar", http.StatusOK, ""},
+		{"GET", "/bar/", http.StatusOK, ""},
+		{"GET", "/bar//", http.StatusOK, ""},
+		{"GET", "/Bar", http.StatusNotFound, ""},
+		{"GET", "/users/gopher/", http.StatusOK, ""},
+		{"GET", "/users/Gopher", http.StatusMovedPermanently, "/users/Gopher/"},
+		{"GET", "/users/Alice/", http.StatusOK, ""},
+		{"GET", "/USERS/Alice/", http.StatusMovedPermanently, "/users/Alice/"},
+		{"GET", "/Users/aLiCe", http.StatusMovedPermanently, "/users/aLiCe/"},
+		{"GET", "/files/a/", http.StatusOK, ""},
+		{"GET", "/files/A//b", http.StatusMovedPermanently, "/files/A/b"},
+		{"GET", "/FILES/A/b", http.StatusMovedPermanently, "/files/A/b"},
+		{"GET", "/baz", http.StatusOK, ""},
+		{"GET", "/Baz", http.StatusOK, ""},
+		{"GET", "/BAZ", http.StatusMovedPermanently, "/baz"},
+		{"GET", "/Docs/ReadMe.JSON", http.StatusMovedPermanently, "/docs/ReadMe.json"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != test.code || w.Header().Get("Location") != test.location {
+			t.Errorf("%s %s: want %d %q, got %d %q",
+				test.method, test.path, test.code, test.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRouteOtherMethods(t *testing.T) {
+	var got string
+	router := New()
+	router.GET("/api/*path", func(_ http.ResponseWriter, _ *http.Request, vars map[string]string) {
+		got = "local " + vars["path"]
+	}).OtherMethods(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got = "proxy " + req.Method + " " + VarsFromContext(req.Context())["path"]
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	router.POST("/api/*path", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		got = "local post"
+	})
+	router.GET("/users/:id", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {})
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		want   string
+	}{
+		{"GET", "/api/users/5", http.StatusOK, "local /users/5"},
+		{"POST", "/api/users", http.StatusOK, "local post"},
+		{"DELETE", "/api/users/5", http.StatusAccepted, "proxy DELETE /users/5"},
+		{"PURGE", "/api/cache", http.StatusAccepted, "proxy PURGE /cache"},
+		{"DELETE", "/users/5", http.StatusMethodNotAllowed, ""},
+	}
+	for _, test := range tests {
+		got = ""
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != test.code || got != test.want {
+			t.Errorf("%s %s: want %d %q, got %d %q", test.method, test.path, test.code, test.want, w.Code, got)
+		}
+	}
+
+	if recv := catchPanic(func() { router.GET("/static", nil).OtherMethods(http.NotFoundHandler()) }); recv == nil {
+		t.Error("no panic for OtherMethods of a route without catch-all")
+	}
+}
+
+func TestRouteRecover(t *testing.T) {
+	fail := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		panic("flaky")
+	}
+
+	router := New()
+	router.PanicHandler = func(w http.ResponseWriter, _ *http.Request, rcv interface{}) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, "global: ", rcv)
+	}
+	router.GET("/widget", fail).Recover(func(w http.ResponseWriter, _ *http.Request, rcv interface{}) {
+		fmt.Fprint(w, "cached: ", rcv)
+	})
+	router.GET("/other", fail)
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/widget", http.StatusOK, "cached: flaky"},
+		{"/other", http.StatusInternalServerError, "global: flaky"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", test.path, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != test.code || w.Body.String() != test.body {
+			t.Errorf("%s: want %d %q, got %d %q", test.path, test.code, test.body, w.Code, w.Body.String())
+		}
+	}
+
+	// The route recovers its panics even if the router doesn't.
+	router = New()
+	router.GET("/widget", fail).Recover(func(w http.ResponseWriter, _ *http.Request, _ interface{}) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/widget", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("panic not recovered by the route: got %d", w.Code)
+	}
+}
+
+func TestRouteNoContent(t *testing.T) {
+	router := New()
+	router.DELETE("/empty", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}).NoContent()
+	router.DELETE("/body", func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		io.WriteString(w, "deleted")
+	}).NoContent()
+	router.DELETE("/status", func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		w.WriteHeader(http.StatusAccepted)
+	}).NoContent()
+	router.DELETE("/gzip", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}).NoContent().Gzip()
+	router.DELETE("/plain", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {})
+	router.HandleNext("DELETE", "/declined", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string, next func()) {
+		next()
+	}).NoContent()
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/empty", http.StatusNoContent, ""},
+		{"/body", http.StatusOK, "deleted"},
+		{"/status", http.StatusAccepted, ""},
+		{"/gzip", http.StatusNoContent, ""},
+		{"/plain", http.StatusOK, ""},
+		{"/declined", http.StatusNotFound, "404 page not found\n"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", test.path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		router.ServeHTTP(w, req)
+		if w.Code != test.code || w.Body.String() != test.body {
+			t.Errorf("%s: want %d %q, got %d %q", test.path, test.code, test.body, w.Code, w.Body.String())
+		}
+		if test.code == http.StatusNoContent && w.Header().Get("Content-Encoding") != "" {
+			t.Errorf("%s: 204 response with Content-Encoding %q", test.path, w.Header().Get("Content-Encoding"))
+		}
+	}
+}
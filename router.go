@@ -44,6 +44,7 @@
 //	:name		Parameter
 //	*name		CatchAll
 //
+// The names of wildcards may only contain letters, digits and '_'.
 // The value of wildcards is saved in a map as vars["name"] = value. The map is
 // passed to the Handle func as a parameter.
 //
@@ -58,6 +59,27 @@
 //		 /blog/go/							no match
 //		 /bloc/go/request-routers/comments	no match
 //
+// The name of a parameter ends at a '.', thus a parameter can be followed by
+// a literal within the same segment. Its value then ends at the first
+// occurrence of the literal:
+//
+//	Path: /files/:name.:ext
+//
+//	Requests:
+//	 /files/report.pdf					match: name="report", ext="pdf"
+//	 /files/a.b.c						match: name="a", ext="b.c"
+//	 /files/readme						no match
+//
+// Likewise, a parameter can be preceded and followed by literals, e.g. to
+// match fixed-format file names. If the same parameter is followed by several
+// literals, the value ends at the first character they have in common:
+//
+//	Path: /report-:id.json
+//
+//	Requests:
+//	 /report-42.json					match: id="42"
+//	 /report-42.xml						no match
+//
 // CatchAll wildcards match anything until the path end, including the directory
 // index (the '/' before the CatchAll). Since they match anything until the end,
 // CatchAll wildcards must always be the final path element.
@@ -69,31 +91,211 @@
 //	 /files/LICENSE						match: filepath="/LICENSE"
 //	 /files/templates/article.html		match: filepath="/templates/article.html"
 //	 /files								no match, but the router would redirect
+//
+// A parameter with a trailing '+' is greedy: its value spans one or more path
+// segments, up to the static segment which must follow it. The value ends at
+// the first occurrence of the static path for which the rest of the request
+// path matches, thus the matcher backtracks to later occurrences if needed:
+//
+//	Path: /repos/:owner/:repo+/contents/*path
+//
+//	Requests:
+//	 /repos/a/b/contents/README			match: owner="a", repo="b", path="/README"
+//	 /repos/a/b/c/contents/x/y			match: owner="a", repo="b/c", path="/x/y"
+//	 /repos/a/contents/x				no match
+//
+// A greedy parameter must be a whole segment followed by a static segment,
+// e.g. /:repo+ or /:repo+/:sha can't be registered, and it conflicts with a
+// non-greedy parameter at the same position.
+//
+// A parameter and a CatchAll wildcard can follow the same path, e.g.
+// /files/:name and /files/*filepath. A request path is then matched in the
+// order: static path elements, parameters, CatchAll wildcards. If the path
+// doesn't match the routes below the parameter, the CatchAll matches it:
+//
+//	Requests:
+//	 /files/readme						match: /files/:name with name="readme"
+//	 /files/templates/article.html		match: /files/*filepath
+//
+// Likewise, static routes can follow the same path as a CatchAll wildcard,
+// e.g. /health and /*filepath. The static routes take precedence, the
+// CatchAll matches all other paths.
+//
+// By default, the most specific route matching a path wins: static path
+// elements before parameters before CatchAll wildcards, and a deeper CatchAll
+// before the ones of its parent paths. Route.MatchPriority overrides this
+// order for a path matched by several routes, the route with the highest
+// match priority wins:
+//
+//	router.GET("/files/:name", File)
+//	router.GET("/files/*filepath", Files).MatchPriority(1)
+//
+//	Requests:
+//	 /files/readme						match: /files/*filepath
+//
+// Wildcards at the same position of several routes must have the same name,
+// e.g. /user/:id/posts and /user/:uid/comments can't be registered together.
 package httprouter
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // Handle is a function that can be registered to a route to handle HTTP
 // requests. Like http.HandlerFunc, but has a third parameter for the values of
 // wildcards (variables).
+// The values are stored in a map, thus they have no order. ParseWildcards
+// returns the wildcards of the route pattern in the order they appear in it,
+// which allows to iterate over the values in that order, e.g. to build a
+// composite key.
 type Handle func(http.ResponseWriter, *http.Request, map[string]string)
 
+// StandardMethods are the HTTP methods defined by RFC 7231 and RFC 5789.
+var StandardMethods = []string{
+	"GET",
+	"HEAD",
+	"POST",
+	"PUT",
+	"PATCH",
+	"DELETE",
+	"CONNECT",
+	"OPTIONS",
+	"TRACE",
+}
+
+// IsStandardMethod reports whether m is one of the StandardMethods.
+// Since methods are case-sensitive, e.g. "get" is not a standard method.
+func IsStandardMethod(m string) bool {
+	for _, method := range StandardMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
 // NotFound is the default HTTP handle func for routes that can't be matched
 // with on existing route.
 // NotFound tries to redirect to a canonical URL generated with CleanPath,
 // Otherwise the request is delegated to http.NOTFOUND.
+// GET and HEAD requests are redirected with http status code 301, all other
+// requests with 308, which preserves the method and body of the request.
 func NotFound(w http.ResponseWriter, req *http.Request) {
+	if cp, ok := cleanPathRedirect(req); ok {
+		http.Redirect(w, req, withQuery(cp, req), permanentRedirectCode(req.Method))
+		return
+	}
+
+	http.NotFound(w, req)
+}
+
+// cleanPathRedirect returns the canonical path generated with CleanPath to
+// redirect the request to, if it differs from the request path.
+func cleanPathRedirect(req *http.Request) (string, bool) {
 	if req.Method != "CONNECT" {
 		path := req.URL.Path
 		if cp := CleanPath(path); cp != path && cp != req.Referer() {
-			http.Redirect(w, req, cp, http.StatusMovedPermanently)
-			return
+			return cp, true
 		}
 	}
+	return "", false
+}
 
-	http.NotFound(w, req)
+// withQuery appends the query string of the request to the path, if any.
+func withQuery(path string, req *http.Request) string {
+	if req.URL.RawQuery == "" {
+		return path
+	}
+	return path + "?" + req.URL.RawQuery
+}
+
+// ErrorFormat defines the format of the error responses written by the
+// Router itself.
+type ErrorFormat uint8
+
+const (
+	// ErrorText writes errors as plain text, like http.Error.
+	ErrorText ErrorFormat = iota
+
+	// ErrorJSON writes errors as a JSON object with the error message and the
+	// http status code, e.g.:
+	//
+	//	{"error":"Not Found","status":404}
+	ErrorJSON
+)
+
+// TrailingSlashPolicy defines how the Router canonicalizes trailing slashes
+// of request paths before routing.
+type TrailingSlashPolicy uint8
+
+const (
+	// TrailingSlashAsIs routes request paths as they are.
+	TrailingSlashAsIs TrailingSlashPolicy = iota
+
+	// AddTrailingSlash redirects requests for paths without a trailing slash
+	// to the path with a trailing slash, if a handle exists for it.
+	AddTrailingSlash
+
+	// StripTrailingSlash redirects requests for paths with a trailing slash to
+	// the path without the trailing slash, if a handle exists for it.
+	StripTrailingSlash
+)
+
+// apply returns path normalized according to the policy.
+func (p TrailingSlashPolicy) apply(path string) string {
+	if path == "/" {
+		return path
+	}
+
+	switch p {
+	case AddTrailingSlash:
+		if path[len(path)-1] != '/' {
+			return path + "/"
+		}
+	case StripTrailingSlash:
+		if path[len(path)-1] == '/' {
+			return path[:len(path)-1]
+		}
+	}
+	return path
+}
+
+// CatchAllRootMode defines how a request for the path of a CatchAll route
+// without the trailing slash, e.g. /files for /files/*filepath, is handled.
+type CatchAllRootMode uint8
+
+const (
+	// CatchAllRootRedirect doesn't match the path. Instead, a redirect to
+	// the path with the trailing slash is recommended, which the Router
+	// issues if RedirectTrailingSlash is enabled.
+	CatchAllRootRedirect CatchAllRootMode = iota
+
+	// CatchAllRootEmpty matches the path with an empty value, e.g.
+	// filepath="" for /files.
+	CatchAllRootEmpty
+
+	// CatchAllRootSlash matches the path like the path with the trailing
+	// slash, e.g. filepath="/" for /files.
+	CatchAllRootSlash
+)
+
+// permanentRedirectCode returns the http status code for a permanent redirect
+// of a request with the given method. GET and HEAD requests are redirected
+// with 301, all other requests with 308.
+func permanentRedirectCode(method string) int {
+	if method != "GET" && method != "HEAD" {
+		return http.StatusPermanentRedirect
+	}
+	return http.StatusMovedPermanently
 }
 
 // Router is a http.Handler which can be used to dispatch requests to different
@@ -107,16 +309,328 @@ type Router struct {
 	// client is redirected to /foo with http status code 301.
 	RedirectTrailingSlash bool
 
+	// If enabled, requests which RedirectTrailingSlash would redirect are
+	// delegated to the NotFound handler instead, which can decide to redirect
+	// or to render a page. The redirect target is stored in the request
+	// context and can be retrieved with TrailingSlashRedirectFromContext.
+	// If there is no custom NotFound handler for the request, e.g. with the
+	// default NotFound func of this package, it is redirected.
+	DeferTrailingSlashRedirect bool
+
+	// Canonicalizes the trailing slash of request paths. Unlike
+	// RedirectTrailingSlash, the client is redirected even if a handle exists
+	// for the requested path, as long as a handle exists for the canonical
+	// path.
+	// For example with AddTrailingSlash, if /foo is requested and a route
+	// exists for /foo/, the client is redirected to /foo/ with http status
+	// code 301 for GET and HEAD requests and 308 for all other methods, which
+	// keeps the method and body of the request.
+	TrailingSlashPolicy TrailingSlashPolicy
+
+	// Defines how a request for the path of a CatchAll route without the
+	// trailing slash is handled, e.g. /files for /files/*filepath.
+	// By default it doesn't match, but is redirected to /files/.
+	CatchAllRoot CatchAllRootMode
+
+	// If enabled, CatchAll wildcards only match values with at least one
+	// non-empty path segment, e.g. /download/*file matches /download/a, but
+	// not /download/, which is handled like a request for an unknown path.
+	// It takes precedence over CatchAllRoot.
+	CatchAllRequiresSegment bool
+
+	// If enabled, consecutive slashes in request paths are treated as one, e.g.
+	// /a//b is routed like /a/b without redirecting the client first.
+	// Redirects issued by the router, e.g. for trailing slashes, are to the
+	// path with the merged slashes.
+	MergeSlashes bool
+
+	// If set, only requests whose Host matches the pattern are routed, e.g.
+	// ":tenant.example.com" for the subdomains of example.com. Labels
+	// beginning with ':' are parameters matching one label of the host, whose
+	// values are added to the vars of the matched route, alongside the path
+	// wildcards. Path wildcards of the same name take precedence.
+	// Requests for other hosts are handled like requests for unknown paths,
+	// and TryServeHTTP doesn't handle them, thus a Chain falls through to the
+	// next router, e.g. the one for the apex domain.
+	HostPattern string
+
+	// If enabled, the children of tree nodes are kept sorted instead of being
+	// reordered by their priority, thus the tree, as shown by DumpTree, doesn't
+	// depend on the order the routes are registered in. Routes are matched
+	// alike, only the order in which child nodes are considered differs.
+	// It must be set before any route is registered.
+	StablePriorities bool
+
+	// Characters which terminate the value of a parameter, in addition to '/'.
+	// For example with ".", the path /metrics/:group.:name matches
+	// /metrics/cpu.load with group="cpu" and name="load", while /metrics/:group
+	// doesn't match it.
+	// It must be set before any route with parameters is registered.
+	ParamSeparators string
+
+	// The maximum length of the value of a parameter. A request with a longer
+	// value doesn't match the route, which protects handles from huge values.
+	// 0 means no limit.
+	MaxParamLength int
+
+	// If enabled, registering a handle for a method and path which already has
+	// a handle is a no-op instead of a panic. The already registered route is
+	// kept. Since handles can't be compared, any handle registered for the
+	// exact same method and path is considered identical.
+	AllowIdenticalReregistration bool
+
+	// If enabled, registering a path which may match the same request paths as
+	// another path registered for the method panics, instead of resolving the
+	// ambiguity when matching requests, e.g. /users/:id and /users/*rest both
+	// match /users/42. Registering the same path again, e.g. for candidate
+	// routes with Route.When, is still allowed. BuildFrom returns the
+	// ambiguity as error.
+	// Each registration is checked against all registered paths of the method.
+	StrictRoutes bool
+
+	// If enabled, a '/' is prepended to registered paths which don't begin
+	// with one, e.g. "users/:id" is registered as "/users/:id". Otherwise
+	// registering such a path panics.
+	AutoPrefixSlash bool
+
+	// If enabled, requests whose path only matches routes of other methods are
+	// handled like requests for unknown paths instead of being answered with
+	// "405 Method Not Allowed" and an Allow header, which doesn't reveal the
+	// methods registered for a path.
+	HideMethodNotAllowed bool
+
+	// The http status code for requests whose path only matches routes of
+	// other methods, if their method is neither one of the StandardMethods
+	// nor registered for any path, e.g. 501 Not Implemented to signal that
+	// the server doesn't support the method at all. Such requests are
+	// answered in the ErrorFormat without calling MethodNotAllowed.
+	// If it is 0, they are answered like requests with a standard method,
+	// with "405 Method Not Allowed".
+	UnknownMethodStatus int
+
+	// If enabled, the methods with a handle registered for the request path
+	// are stored in the request context before the handle is invoked. They can
+	// be retrieved with AllowedMethodsFromContext.
+	ExposeAllowedMethods bool
+
+	// If enabled, a Link header advertising the methods with a handle
+	// registered for the request path is added to the responses of matched
+	// requests, with one entry per method, e.g.:
+	//
+	//	Link: </users>; rel="allow"; method="GET", </users>; rel="allow"; method="POST"
+	EmitLinkHeader bool
+
+	// If enabled, requests made via HTTP are redirected to the same URL with
+	// the https scheme before routing. GET and HEAD requests are redirected
+	// with http status code 301, all other requests with 308.
+	RequireHTTPS bool
+
+	// If enabled, the X-Forwarded-Proto header set by a proxy or load balancer
+	// is trusted to determine whether the request was made via HTTPS.
+	// Only enable it if the header is always set by a trusted proxy.
+	TrustForwardedProto bool
+
+	// The format of the error responses written by the router, e.g. for
+	// "404 Not Found" unless a custom NotFound handler is set, or for
+	// "405 Method Not Allowed".
+	// Set PanicHandler to InternalServerError to answer recovered panics in
+	// the format as well.
+	ErrorFormat ErrorFormat
+
+	// If set, it is called after each lookup in the routing tree with the
+	// number of tree nodes visited to match the path, e.g. to detect
+	// pathologically deep trees.
+	TraversalObserver func(method, path string, nodesVisited int)
+
+	// If set, the router sends an event to the channel for each registered
+	// route and for the requests it dispatches with ServeHTTP to a route or
+	// handles as not found, e.g. to observe the router in a dashboard.
+	// Events are sent without blocking, thus they are dropped if the channel
+	// isn't ready to receive them, which a buffered channel avoids.
+	Events chan<- RouterEvent
+
+	// If greater than 1, only every n-th request is reported to Events.
+	// Registrations are always reported.
+	EventSampleRate int
+
+	// Configurable handle which is used for requests of the root path "/",
+	// if no route matches them, e.g. to serve a landing page. A route
+	// registered for "/" takes precedence.
+	RootHandler Handle
+
+	// Configurable func which is used for all redirects issued by the router
+	// itself, e.g. because of RedirectTrailingSlash or RequireHTTPS, instead of
+	// http.Redirect. The target includes the query string of the request.
+	// Unclean paths are redirected with it as well, unless a custom NotFound
+	// handler is set.
+	RedirectHandler func(w http.ResponseWriter, r *http.Request, newPath string)
+
+	// Configurable handle func which is used for "OPTIONS *" requests, which
+	// are requests about the server as a whole. If it is nil, they are
+	// answered with an Allow header listing all methods with a registered
+	// handle and OPTIONS.
+	GlobalOPTIONS http.HandlerFunc
+
 	// Configurable handle func which is used when no matching route is found.
-	// Default is the NotFound func of this package.
+	// Default is the NotFound func of this package. If it is the default or
+	// nil, the router handles the request like the NotFound func itself, but
+	// writes the error in the ErrorFormat.
 	NotFound http.HandlerFunc
 
+	// Configurable handler func which is used when a request can't be routed
+	// because no handle is registered for its method, but for other methods.
+	// The Allow header is set before it is called, and the allowed methods can
+	// be retrieved from the request context with AllowedMethodsFromContext.
+	// If it is nil, the request is answered with "405 Method Not Allowed" in
+	// the ErrorFormat.
+	MethodNotAllowed http.HandlerFunc
+
+	// Handler funcs which are used instead of NotFound when no matching route
+	// is found for a request with the method of the map key, e.g. to answer
+	// API requests with JSON and page requests with HTML.
+	NotFoundByMethod map[string]http.HandlerFunc
+
+	// If enabled, registered routes are only recorded and inserted into the
+	// routing tree when the first request which may match them is served,
+	// which are all routes with the same first path segment and the routes
+	// beginning with a wildcard. This reduces the startup time and the memory
+	// usage of services with many routes of which only some are requested.
+	// On the other hand, the first request for a path segment is slower, and
+	// all lookups hold a read lock as long as routes are pending. Conflicting
+	// routes only panic once they are compiled, call Compile to detect them.
+	// It must be set before any route is registered.
+	LazyCompile bool
+
+	// The maximum number of routes which can be registered, e.g. to guard
+	// against a plugin registering routes in a loop. Registering a further
+	// route panics. Each path registered for a route counts, including the
+	// paths added for defaults (see Route.Default). If it is 0, the number of
+	// routes is unlimited.
+	MaxRoutes int
+
+	// The time handles may take to answer a request, which can be overridden
+	// per route with Route.Timeout. The request context of the handle has
+	// the deadline. If it is exceeded, the request is answered with
+	// "503 Service Unavailable" in the ErrorFormat. Since the handle runs in
+	// its own goroutine and its response is buffered until it returns, it
+	// can't flush the response or hijack the connection.
+	// If it is 0, handles have no timeout.
+	HandlerTimeout time.Duration
+
+	// The maximum number of requests served by ServeHTTP at the same time,
+	// e.g. to protect downstream resources during spikes. Further requests
+	// are rejected with the Overloaded handler until a request in flight is
+	// done.
+	// If it is 0, the number of concurrent requests is unlimited.
+	MaxConcurrent int
+
+	// Configurable handler func which is used for requests rejected because
+	// of MaxConcurrent. If it is nil, they are answered with
+	// "503 Service Unavailable" in the ErrorFormat.
+	Overloaded http.HandlerFunc
+
 	// Handler func to handle panics recovered from http handlers.
 	// It should be used to generate an error page and return the http error code
 	// "500 - Internal Server Error".
 	// The handle can be used to keep your server from crashing because of
 	// irrecoverable panics.
 	PanicHandler func(http.ResponseWriter, *http.Request, interface{})
+
+	// Like PanicHandler, but also receives the pattern and the wildcard values
+	// of the route whose handle panicked, e.g. for error tracking. It takes
+	// precedence over PanicHandler.
+	PanicHandlerWithContext func(http.ResponseWriter, *http.Request, PanicContext)
+
+	// Configures the request IDs attached to requests before they are
+	// dispatched. See RequestIDConfig.
+	RequestID RequestIDConfig
+
+	// If set, the router is in maintenance mode and answers requests with
+	// "503 Service Unavailable" instead of dispatching them, see
+	// MaintenanceConfig. To switch the mode while requests are served, set
+	// it on a Snapshot of the router and Install the snapshot.
+	Maintenance *MaintenanceConfig
+
+	// The number of registered routes.
+	routes int
+
+	// The routes registered with LazyCompile which aren't compiled yet.
+	lazy *lazyRoutes
+
+	// Whether a route has an explicit match priority.
+	matchPriorities bool
+
+	// Whether a route redirects to its canonical path.
+	canonicalRoutes bool
+
+	// Whether a route has a handler for other methods.
+	otherMethods bool
+
+	// The number of requests reported to Events, for sampling.
+	eventSeq uint64
+
+	// The number of requests in flight, limited by MaxConcurrent.
+	inFlight int64
+
+	// Whether routes are registered by BuildFrom, and the memory preallocated
+	// for their routes and nodes.
+	bulk      bool
+	routeSlab []Route
+	nodeSlab  []node
+
+	// The snapshot installed with Install, and whether the router is a
+	// snapshot itself.
+	live   atomic.Value
+	frozen bool
+
+	// The sorted methods with at least one registered handle.
+	methods []string
+
+	// The middleware added with Use.
+	middleware []Middleware
+
+	// The handler set with SPA.
+	spa http.Handler
+
+	// The HEAD routes registered by HandleStd for GET patterns, by path,
+	// which a HEAD pattern for the path replaces.
+	stdHead map[string]*Route
+}
+
+// getValue is like node.getValue, but matches with the options of the router.
+func (r *Router) getValue(method, path string) (route *Route, vars map[string]string, tsr bool) {
+	route, vars, tsr, _ = r.matchFrom(method, path, 0)
+	return
+}
+
+// matchFrom is like getValue, but if catchAllAt is not 0 the match begins with
+// the catch-all passed at the offset catchAllAt in the path. It also returns
+// the offset of the next catch-all to match if the routes matched decline the
+// request, see node.match.
+func (r *Router) matchFrom(method, path string, catchAllAt int) (route *Route, vars map[string]string, tsr bool, fallback int) {
+	if r.lazy.active() {
+		r.compileFor(path)
+		r.lazy.mu.RLock()
+		defer r.lazy.mu.RUnlock()
+	}
+
+	opts := matchOptions{
+		maxParamLength: r.MaxParamLength,
+		catchAllAt:     catchAllAt,
+		catchAllRoot:   r.CatchAllRoot,
+		priorities:     r.matchPriorities,
+
+		catchAllRequiresSegment: r.CatchAllRequiresSegment,
+	}
+	if r.TraversalObserver == nil {
+		return r.match(method, path, opts)
+	}
+
+	var visited int
+	opts.visited = &visited
+	route, vars, tsr, fallback = r.match(method, path, opts)
+	r.TraversalObserver(method, path, visited)
+	return
 }
 
 // Make sure the Router conforms with the http.Handler interface.
@@ -133,28 +647,28 @@ func New() *Router {
 }
 
 // GET is a shortcut for router.Handle("GET", path, handle)
-func (r *Router) GET(path string, handle Handle) {
-	r.Handle("GET", path, handle)
+func (r *Router) GET(path string, handle Handle) *Route {
+	return r.Handle("GET", path, handle)
 }
 
 // POST is a shortcut for router.Handle("POST", path, handle)
-func (r *Router) POST(path string, handle Handle) {
-	r.Handle("POST", path, handle)
+func (r *Router) POST(path string, handle Handle) *Route {
+	return r.Handle("POST", path, handle)
 }
 
 // PUT is a shortcut for router.Handle("PUT", path, handle)
-func (r *Router) PUT(path string, handle Handle) {
-	r.Handle("PUT", path, handle)
+func (r *Router) PUT(path string, handle Handle) *Route {
+	return r.Handle("PUT", path, handle)
 }
 
 // PATCH is a shortcut for router.Handle("PATCH", path, handler)
-func (r *Router) PATCH(path string, handle Handle) {
-	r.Handle("PATCH", path, handle)
+func (r *Router) PATCH(path string, handle Handle) *Route {
+	return r.Handle("PATCH", path, handle)
 }
 
 // DELETE is a shortcut for router.Handle("DELETE", path, handle)
-func (r *Router) DELETE(path string, handle Handle) {
-	r.Handle("DELETE", path, handle)
+func (r *Router) DELETE(path string, handle Handle) *Route {
+	return r.Handle("DELETE", path, handle)
 }
 
 // Handle registers a new request handle with the given path and method.
@@ -165,21 +679,424 @@ func (r *Router) DELETE(path string, handle Handle) {
 // This function is intended for bulk loading and to allow the usage of less
 // frequently used, non-standardized or custom methods (e.g. for internal
 // communication with a proxy).
-func (r *Router) Handle(method, path string, handle Handle) {
-	if path[0] != '/' {
-		panic("path must begin with '/'")
+//
+// The returned Route can be used to set further options for the route.
+func (r *Router) Handle(method, path string, handle Handle) *Route {
+	if len(path) == 0 || path[0] != '/' {
+		if !r.AutoPrefixSlash {
+			panic("path must begin with '/'")
+		}
+		path = "/" + path
+	}
+
+	if r.AllowIdenticalReregistration {
+		// If the route has a predicate, the new route is registered as a
+		// further candidate instead.
+		r.compileFor(path)
+		if n := r.findPattern(path); n != nil {
+			if route := n.handle.get(method); route != nil && route.when == nil {
+				return route
+			}
+		}
+	}
+
+	route := r.newRoute()
+	*route = Route{
+		Method: method,
+		Path:   path,
+		Handle: handle,
+		router: r,
+	}
+	r.register(method, path, route)
+
+	if i := sort.SearchStrings(r.methods, method); i == len(r.methods) || r.methods[i] != method {
+		r.methods = append(r.methods, "")
+		copy(r.methods[i+1:], r.methods[i:])
+		r.methods[i] = method
+	}
+	return route
+}
+
+// register adds the route for the method and path to the tree, unless
+// MaxRoutes would be exceeded.
+func (r *Router) register(method, path string, route *Route) {
+	if r.frozen {
+		panic("can't register " + method + " " + path + ": the router is a read-only snapshot")
+	}
+	if r.MaxRoutes > 0 && r.routes >= r.MaxRoutes {
+		panic("can't register " + method + " " + path + ": the maximum number of " +
+			strconv.Itoa(r.MaxRoutes) + " routes is reached")
+	}
+	if r.StrictRoutes {
+		r.checkAmbiguity(method, path)
+	}
+	if r.LazyCompile {
+		if r.lazy == nil {
+			r.lazy = new(lazyRoutes)
+		}
+		r.lazy.add(method, path, route)
+	} else {
+		r.addRoute(method, path, route)
+	}
+	r.routes++
+	if r.Events != nil {
+		r.emit(EventRegistered, method, path, "")
 	}
-	r.addRoute(method, path, handle)
+}
+
+// NextHandle is a Handle which can decline a request by calling next instead
+// of handling it. In that case it must not write to the http.ResponseWriter.
+type NextHandle func(w http.ResponseWriter, r *http.Request, vars map[string]string, next func())
+
+// HandleNext registers a NextHandle with the given path and method.
+// If the handle declines a request, the router continues with the next
+// candidate route registered for the same method and path (see Route.When),
+// or with the NotFound handler if there is none.
+func (r *Router) HandleNext(method, path string, handle NextHandle) *Route {
+	route := r.Handle(method, path, func(w http.ResponseWriter, req *http.Request, vars map[string]string) {
+		handle(w, req, vars, func() {
+			r.handleNotFound(w, req)
+		})
+	})
+	route.nextHandle = handle
+	return route
 }
 
 // HandlerFunc is an adapter which allows the usage of a http.HandlerFunc as a
 // request handle.
-func (r *Router) HandlerFunc(method, path string, handler http.HandlerFunc) {
-	r.Handle(method, path,
-		func(w http.ResponseWriter, req *http.Request, _ map[string]string) {
-			handler(w, req)
-		},
-	)
+// The values of wildcards are stored in the request context and can be
+// retrieved with VarsFromContext.
+func (r *Router) HandlerFunc(method, path string, handler http.HandlerFunc) *Route {
+	return r.Handle(method, path, handlerFuncHandle(handler))
+}
+
+// handlerFuncHandle returns a Handle which calls the handler with the values
+// of the wildcards stored in the request context.
+func handlerFuncHandle(handler http.HandlerFunc) Handle {
+	return func(w http.ResponseWriter, req *http.Request, vars map[string]string) {
+		if len(vars) > 0 {
+			req = req.WithContext(context.WithValue(req.Context(), varsKey{}, vars))
+		}
+		handler(w, req)
+	}
+}
+
+// HandleCtx is a Handle which takes the context of the request as its first
+// parameter, which makes explicit that it should respect the cancellation of
+// the request.
+type HandleCtx func(ctx context.Context, w http.ResponseWriter, r *http.Request, vars map[string]string)
+
+// HandleCtx registers a HandleCtx with the given path and method. The handle
+// is invoked with the context of the request.
+func (r *Router) HandleCtx(method, path string, handle HandleCtx) *Route {
+	return r.Handle(method, path, func(w http.ResponseWriter, req *http.Request, vars map[string]string) {
+		handle(req.Context(), w, req, vars)
+	})
+}
+
+// GETCtx is a shortcut for router.HandleCtx("GET", path, handle)
+func (r *Router) GETCtx(path string, handle HandleCtx) *Route {
+	return r.HandleCtx("GET", path, handle)
+}
+
+// POSTCtx is a shortcut for router.HandleCtx("POST", path, handle)
+func (r *Router) POSTCtx(path string, handle HandleCtx) *Route {
+	return r.HandleCtx("POST", path, handle)
+}
+
+// PUTCtx is a shortcut for router.HandleCtx("PUT", path, handle)
+func (r *Router) PUTCtx(path string, handle HandleCtx) *Route {
+	return r.HandleCtx("PUT", path, handle)
+}
+
+// PATCHCtx is a shortcut for router.HandleCtx("PATCH", path, handle)
+func (r *Router) PATCHCtx(path string, handle HandleCtx) *Route {
+	return r.HandleCtx("PATCH", path, handle)
+}
+
+// DELETECtx is a shortcut for router.HandleCtx("DELETE", path, handle)
+func (r *Router) DELETECtx(path string, handle HandleCtx) *Route {
+	return r.HandleCtx("DELETE", path, handle)
+}
+
+// HandleStd registers the handler for a pattern in the syntax of
+// http.ServeMux (Go 1.22), which eases the migration from it. The pattern may
+// begin with a method, wildcards {name} are converted to parameters :name and
+// wildcards {name...} to catch-all wildcards *name. For example
+// "GET /items/{id}" is registered as router.Handle("GET", "/items/:id", ...).
+// Patterns without a method are registered for all StandardMethods.
+//
+// The values of wildcards are stored in the request context and can be
+// retrieved with VarsFromContext. Like with http.ServeMux, the values of
+// {name...} wildcards don't begin with '/'.
+// Like with http.ServeMux, a pattern with the method GET matches HEAD
+// requests as well, unless a pattern with the method HEAD is registered for
+// the same path, before or after it.
+// Unlike http.ServeMux, a pattern ending with '/' only matches the path
+// itself; "{$}" at the end of a pattern is ignored. Patterns with a host
+// aren't supported.
+func (r *Router) HandleStd(pattern string, handler http.Handler) {
+	methods := StandardMethods
+	if i := strings.IndexAny(pattern, " \t"); i >= 0 {
+		methods = []string{pattern[:i]}
+		pattern = strings.TrimLeft(pattern[i:], " \t")
+	}
+
+	path, catchAll := convertStdPattern(pattern)
+	handle := handlerFuncHandle(func(w http.ResponseWriter, req *http.Request) {
+		if catchAll != "" {
+			vars := VarsFromContext(req.Context())
+			vars[catchAll] = strings.TrimPrefix(vars[catchAll], "/")
+		}
+		handler.ServeHTTP(w, req)
+	})
+	for _, method := range methods {
+		switch {
+		case method == "HEAD" && r.stdHead[path] != nil:
+			// The HEAD pattern takes precedence over the GET pattern.
+			r.stdHead[path].Handle = handle
+			delete(r.stdHead, path)
+		case method == "GET" && len(methods) == 1:
+			r.Handle(method, path, handle)
+			if _, ok := r.HandlerFor("HEAD", path); !ok {
+				if r.stdHead == nil {
+					r.stdHead = make(map[string]*Route)
+				}
+				r.stdHead[path] = r.Handle("HEAD", path, handle)
+			}
+		default:
+			r.Handle(method, path, handle)
+		}
+	}
+}
+
+// Subtree registers the handle for all StandardMethods for the path and all
+// paths below it, e.g. for a section of the site mounted at "/admin". The
+// remaining path is passed to the handle as the wildcard "rest", which is
+// empty for the path itself, "/" for the path with a trailing slash and e.g.
+// "/users/5" for "/admin/users/5".
+// It is a shortcut for registering the path and the path followed by the
+// catch-all wildcard "*rest" with the same handle.
+func (r *Router) Subtree(path string, handle Handle) {
+	path = strings.TrimSuffix(path, "/")
+	for _, method := range StandardMethods {
+		route := r.Handle(method, path+"/*rest", handle)
+		if path != "" {
+			route.Default("rest", "")
+		}
+	}
+}
+
+// Proxy registers the handle for all StandardMethods for all paths beginning
+// with the prefix, e.g. to forward requests below "/proxy/" to a backend. The
+// remaining path after the prefix is passed to the handle as the wildcard
+// "rest", e.g. "" for "/proxy/", "a" for "/proxy/a" and "a/b" for
+// "/proxy/a/b". A prefix without a trailing slash is registered with one.
+// Unlike a route with a catch-all wildcard, the prefix itself is matched with
+// an empty rest even if CatchAllRequiresSegment is enabled.
+func (r *Router) Proxy(prefix string, handle Handle) {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	proxy := func(w http.ResponseWriter, req *http.Request, vars map[string]string) {
+		vars["rest"] = strings.TrimPrefix(vars["rest"], "/")
+		handle(w, req, vars)
+	}
+	for _, method := range StandardMethods {
+		r.Handle(method, prefix+"*rest", proxy).matchesEmpty = true
+	}
+}
+
+type prefixKey struct{}
+
+// StripPrefix returns a handler which serves requests with the router after
+// removing the prefix from their path, e.g. to mount the router at "/app/" of
+// a http.ServeMux with routes registered without the prefix. Requests whose
+// path doesn't begin with the prefix are answered with "404 Not Found".
+// Unlike with http.StripPrefix, the redirects issued by the router, e.g. for
+// trailing slashes, and the paths it generates, e.g. for the Link header of
+// EmitLinkHeader, include the prefix.
+func (r *Router) StripPrefix(prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path, ok := stripPathPrefix(req.URL.Path, prefix)
+		rawPath, rawOK := stripPathPrefix(req.URL.RawPath, prefix)
+		if !ok || req.URL.RawPath != "" && !rawOK {
+			http.NotFound(w, req)
+			return
+		}
+
+		req2 := req.WithContext(context.WithValue(req.Context(), prefixKey{}, mountPath(req, prefix)))
+		u := *req.URL
+		u.Path, u.RawPath = path, rawPath
+		req2.URL = &u
+		r.ServeHTTP(w, req2)
+	})
+}
+
+// stripPathPrefix removes the prefix from the path if it is followed by a '/'
+// or the path end, and reports whether it did. The path without the prefix
+// begins with a '/'.
+func stripPathPrefix(path, prefix string) (string, bool) {
+	if path == "" {
+		return "", false
+	}
+	if !strings.HasPrefix(path, prefix) {
+		return path, false
+	}
+	path = path[len(prefix):]
+	if path == "" {
+		return "/", true
+	}
+	return path, path[0] == '/'
+}
+
+// mountPath prepends the prefix stripped with StripPrefix to the path, if
+// any.
+func mountPath(req *http.Request, path string) string {
+	prefix, _ := req.Context().Value(prefixKey{}).(string)
+	return prefix + path
+}
+
+// convertStdPattern converts the path of a http.ServeMux pattern to the path
+// syntax of the router and returns it together with the name of the
+// catch-all wildcard, if any.
+func convertStdPattern(pattern string) (path, catchAll string) {
+	if len(pattern) == 0 || pattern[0] != '/' {
+		panic("patterns with a host are not supported")
+	}
+	pattern = strings.TrimSuffix(pattern, "{$}")
+
+	var b strings.Builder
+	for len(pattern) > 0 {
+		i := strings.IndexByte(pattern, '{')
+		if i < 0 {
+			b.WriteString(pattern)
+			break
+		}
+		j := strings.IndexByte(pattern[i:], '}')
+		if j < 0 {
+			panic("bad wildcard in pattern '" + pattern + "'")
+		}
+		b.WriteString(pattern[:i])
+		name := pattern[i+1 : i+j]
+		if strings.HasSuffix(name, "...") {
+			catchAll = strings.TrimSuffix(name, "...")
+			b.WriteByte('*')
+			b.WriteString(catchAll)
+		} else {
+			b.WriteByte(':')
+			b.WriteString(name)
+		}
+		pattern = pattern[i+j+1:]
+	}
+	return b.String(), catchAll
+}
+
+// GETFunc is a shortcut for router.Handle("GET", path, fn), named to mirror
+// HandlerFunc for handlers which want the values of wildcards as a parameter.
+func (r *Router) GETFunc(path string, fn func(http.ResponseWriter, *http.Request, map[string]string)) *Route {
+	return r.GET(path, fn)
+}
+
+type varsKey struct{}
+
+type allowedKey struct{}
+
+type tsrKey struct{}
+
+// VarsFromContext returns the values of wildcards stored in the request
+// context by HandlerFunc, or nil if there are none.
+func VarsFromContext(ctx context.Context) map[string]string {
+	vars, _ := ctx.Value(varsKey{}).(map[string]string)
+	return vars
+}
+
+// AllowedMethodsFromContext returns the methods allowed for the request path,
+// which are stored in the request context if the Router's
+// ExposeAllowedMethods is enabled, and for the MethodNotAllowed handler.
+func AllowedMethodsFromContext(ctx context.Context) []string {
+	allowed, _ := ctx.Value(allowedKey{}).([]string)
+	return allowed
+}
+
+// TrailingSlashRedirectFromContext returns the path with (without) the trailing
+// slash a request would have been redirected to, which is stored in the
+// request context passed to the NotFound handler if the Router's
+// DeferTrailingSlashRedirect is enabled. The bool reports whether the request
+// would have been redirected.
+func TrailingSlashRedirectFromContext(ctx context.Context) (string, bool) {
+	path, ok := ctx.Value(tsrKey{}).(string)
+	return path, ok
+}
+
+// WrapHandle is an adapter which allows the usage of a Handle where a
+// http.HandlerFunc is expected, e.g. in middleware chains. The values of
+// wildcards are taken from the request context, see VarsFromContext.
+func WrapHandle(h Handle) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		h(w, req, VarsFromContext(req.Context()))
+	}
+}
+
+// Redirect registers a handle for the method and the path fromPattern, which
+// redirects matched requests with the given http status code to a URL built
+// from toTemplate. The wildcards in toTemplate are replaced by the escaped
+// values of the wildcards with the same name in fromPattern, the query string
+// of the request is preserved. The redirect is sent by the RedirectHandler,
+// if set. For example:
+//
+//	router.Redirect("GET", "/old/:id", "/new/:id", http.StatusMovedPermanently)
+func (r *Router) Redirect(method, fromPattern, toTemplate string, code int) *Route {
+	return r.Handle(method, fromPattern, func(w http.ResponseWriter, req *http.Request, vars map[string]string) {
+		target := buildPath(toTemplate, vars)
+		if req.URL.RawQuery != "" {
+			target += "?" + req.URL.RawQuery
+		}
+		r.redirect(w, req, target, code)
+	})
+}
+
+// buildPath replaces the wildcards in the template with their escaped values.
+// Since the values of catch-all wildcards begin with '/', the '/' before a
+// catch-all in the template is dropped. Leading slashes of the result are
+// collapsed, a path beginning with "//" would be taken as a host by clients.
+func buildPath(template string, vars map[string]string) string {
+	var b strings.Builder
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if c != ':' && c != '*' {
+			b.WriteByte(c)
+			continue
+		}
+
+		k := wildcardEnd(template, i, "")
+		value := vars[template[i+1:k]]
+		if c == '*' && strings.HasPrefix(value, "/") && strings.HasSuffix(b.String(), "/") {
+			value = value[1:]
+		}
+		b.WriteString(escapeValue(value, c == '*'))
+		i = k - 1
+	}
+
+	target := b.String()
+	if strings.HasPrefix(target, "//") {
+		target = "/" + strings.TrimLeft(target, "/")
+	}
+	return target
+}
+
+// escapeValue escapes the value of a wildcard for the use in a path. The
+// slashes of catch-all values are kept, they separate the segments.
+func escapeValue(value string, catchAll bool) string {
+	if !catchAll {
+		return url.PathEscape(value)
+	}
+	segments := strings.Split(value, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
 }
 
 // ServeFiles serves files from the given file system root.
@@ -194,49 +1111,956 @@ func (r *Router) HandlerFunc(method, path string, handler http.HandlerFunc) {
 //
 //	router.ServeFiles("/src/*filepath", http.Dir("/var/www"))
 func (r *Router) ServeFiles(path string, root http.FileSystem) {
+	r.ServeFilesWithOptions(path, root, ServeFilesOptions{})
+}
+
+// SPA serves a single page application from the given file system root for
+// GET and HEAD requests which don't match any route, which can't be done with
+// ServeFiles("/*filepath", ...) if other routes are registered. Existing files
+// are served like by ServeFiles, requests for all other paths are answered
+// with the index.html of the root, thus the application can route them on the
+// client side:
+//
+//	router.GET("/api/users", ListUsers)
+//	router.SPA(http.Dir("/var/www"))
+func (r *Router) SPA(root http.FileSystem) {
+	r.spa = newSPAHandler(root)
+}
+
+// ServeFilesOptions are the options for ServeFilesWithOptions.
+type ServeFilesOptions struct {
+	// If enabled, requests for directories without an index.html are answered
+	// with 404 instead of a directory listing.
+	NoDirListing bool
+
+	// Requests for files whose path, relative to the catch-all, begins with
+	// one of these prefixes are delegated to the NotFound handler of the
+	// router. A prefix matches whole path segments only, i.e. "/api" matches
+	// "/api" and "/api/users", but not "/apiary".
+	Except []string
+
+	// If enabled, a precompressed variant of a file, i.e. app.js.gz for
+	// app.js, is served instead of the file itself if the client accepts
+	// gzip. It is served with "Content-Encoding: gzip" and the Content-Type
+	// of the uncompressed file. All responses get "Vary: Accept-Encoding".
+	Precompressed bool
+}
+
+// ServeFilesExcept is like ServeFiles, but doesn't serve files whose path
+// begins with one of the excluded prefixes. It can be used to serve e.g. a
+// single page application from "/*filepath" but still answer unmatched API
+// requests with 404:
+//
+//	router.ServeFilesExcept("/*filepath", http.Dir("/var/www"), []string{"/api"})
+func (r *Router) ServeFilesExcept(path string, root http.FileSystem, except []string) {
+	r.ServeFilesWithOptions(path, root, ServeFilesOptions{Except: except})
+}
+
+// ServeFilesWithOptions is like ServeFiles, but allows to configure how the
+// files are served.
+func (r *Router) ServeFilesWithOptions(path string, root http.FileSystem, opts ServeFilesOptions) {
 	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
 		panic("path must end with '/*filepath'")
 	}
 
+	if opts.NoDirListing {
+		root = noDirListingFS{root}
+	}
 	fileServer := http.FileServer(root)
 
 	r.GET(path, func(w http.ResponseWriter, req *http.Request, vars map[string]string) {
-		req.URL.Path = vars["filepath"]
+		filepath := cleanFilePath(vars["filepath"])
+		for _, prefix := range opts.Except {
+			if hasPathPrefix(filepath, prefix) {
+				r.handleNotFound(w, req)
+				return
+			}
+		}
+
+		if opts.Precompressed {
+			if !headerHasToken(w.Header(), "Vary", "Accept-Encoding") {
+				w.Header().Add("Vary", "Accept-Encoding")
+			}
+			if acceptsGzip(req) && serveGzipFile(w, req, root, filepath) {
+				return
+			}
+		}
+
+		req.URL.Path = filepath
 		fileServer.ServeHTTP(w, req)
 	})
 }
 
+// hasPathPrefix reports whether the path begins with the segments of prefix.
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return strings.HasPrefix(path, prefix) &&
+		(len(path) == len(prefix) || path[len(prefix)] == '/')
+}
+
+// Allowed returns the sorted methods with a handle registered for the path.
+func (r *Router) Allowed(path string) []string {
+	var allowed []string
+	for _, method := range r.methods {
+		if route, _, _ := r.getValue(method, path); route != nil {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+// linkHeader returns the value of a Link header advertising the methods for
+// the path.
+func linkHeader(path string, methods []string) string {
+	var b strings.Builder
+	for i, method := range methods {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("<" + path + `>; rel="allow"; method="` + method + `"`)
+	}
+	return b.String()
+}
+
+// headerHasValue reports whether one of the values of the header is value.
+func headerHasValue(h http.Header, key, value string) bool {
+	for _, v := range h.Values(key) {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// DumpTree returns a textual representation of the routing tree for debugging,
+// one node per line with its priority, path, number of children, indices and
+// the methods of its handles.
+func (r *Router) DumpTree() string {
+	var b strings.Builder
+	r.Compile()
+	r.node.dump(&b, "")
+	return b.String()
+}
+
+// serverMethods returns the sorted methods with a registered handle and
+// OPTIONS, which the server as a whole supports.
+func (r *Router) serverMethods() []string {
+	i := sort.SearchStrings(r.methods, "OPTIONS")
+	if i < len(r.methods) && r.methods[i] == "OPTIONS" {
+		return r.methods
+	}
+	methods := make([]string, 0, len(r.methods)+1)
+	methods = append(methods, r.methods[:i]...)
+	methods = append(methods, "OPTIONS")
+	return append(methods, r.methods[i:]...)
+}
+
+// Pattern returns the registered path pattern matching the method and the
+// request path, e.g. "/user/:id" for "/user/42". The bool reports whether a
+// route matches.
+func (r *Router) Pattern(method, path string) (string, bool) {
+	if route, _, _ := r.getValue(method, path); route != nil {
+		return route.Path, true
+	}
+	return "", false
+}
+
+// Lookup allows the manual lookup of a method + path combo, e.g. to build a
+// framework around this router. If a route matches, its handle and the
+// wildcard values are returned and ok is true. Otherwise redirect is the path
+// with the trailing slash added or removed if a route matches that path, so
+// that the caller can redirect the request itself, or empty.
+func (r *Router) Lookup(method, path string) (handle Handle, vars map[string]string, redirect string, ok bool) {
+	route, vars, tsr := r.getValue(method, path)
+	if route != nil {
+		return route.Handle, vars, "", true
+	}
+	if tsr && path != "/" {
+		redirect = toggleTrailingSlash(path)
+	}
+	return nil, nil, redirect, false
+}
+
+// MatchType is the kind of route matching a path.
+type MatchType uint8
+
+const (
+	// NoMatch means that no route matches the path.
+	NoMatch MatchType = iota
+
+	// StaticMatch is a match of a route without wildcards.
+	StaticMatch
+
+	// ParamMatch is a match of a route with named parameters, but without a
+	// catch-all wildcard.
+	ParamMatch
+
+	// CatchAllMatch is a match of a route with a catch-all wildcard.
+	CatchAllMatch
+)
+
+// Match is the result of matching a method and a path with Router.Match.
+type Match struct {
+	// The handle of the matching route. For routes registered with
+	// HandleNext, it calls the NextHandle and answers declined requests with
+	// the NotFound handler, like Route.Handle.
+	Handle Handle
+
+	// The registered path pattern of the matching route, e.g. "/user/:id".
+	Pattern string
+
+	// The values of the wildcards of the pattern.
+	Params map[string]string
+
+	// Whether a route would match the path with the trailing slash added or
+	// removed, if no route matches.
+	TSR bool
+
+	// The methods with a route matching the path, if no route matches the
+	// method, as in the Allow header of "405 Method Not Allowed" responses.
+	Allowed []string
+
+	// The kind of the matching route.
+	Type MatchType
+}
+
+// Match matches the method and the path like a request, but doesn't serve
+// it. Unlike Lookup, it also reports the pattern and the kind of the matching
+// route, or the methods allowed for the path if no route matches the method.
+func (r *Router) Match(method, path string) Match {
+	route, vars, tsr := r.getValue(method, path)
+	if route == nil {
+		return Match{TSR: tsr && path != "/", Allowed: r.allowed(path)}
+	}
+
+	m := Match{
+		Handle:  route.Handle,
+		Pattern: route.Path,
+		Params:  vars,
+		Type:    StaticMatch,
+	}
+	wildcards, _ := ParseWildcards(route.Path)
+	for _, wildcard := range wildcards {
+		if wildcard.Type == CatchAll {
+			m.Type = CatchAllMatch
+			break
+		}
+		m.Type = ParamMatch
+	}
+	return m
+}
+
+// toggleTrailingSlash removes the trailing slash of the path if it has one
+// and adds one otherwise.
+func toggleTrailingSlash(path string) string {
+	if path[len(path)-1] == '/' {
+		return path[:len(path)-1]
+	}
+	return path + "/"
+}
+
+// HandlerFor returns the handle registered for the method and the path
+// pattern, e.g. "/user/:id", which can be called directly in tests of the
+// handle. Unlike Lookup, the pattern is not matched like a request path but
+// must be the registered pattern itself. The bool reports whether a handle is
+// registered.
+func (r *Router) HandlerFor(method, pattern string) (Handle, bool) {
+	if r.lazy.active() {
+		r.compileFor(pattern)
+		r.lazy.mu.RLock()
+		defer r.lazy.mu.RUnlock()
+	}
+	if n := r.findPattern(pattern); n != nil {
+		if route := n.handle.get(method); route != nil {
+			return route.Handle, true
+		}
+	}
+	return nil, false
+}
+
+// otherMethodsHandler returns the handler set with Route.OtherMethods of a
+// route matching the path for another method, and the values of its
+// wildcards.
+func (r *Router) otherMethodsHandler(path string) (http.Handler, map[string]string) {
+	if !r.otherMethods {
+		return nil, nil
+	}
+	for _, method := range r.methods {
+		if route, vars, _ := r.getValue(method, path); route != nil && route.otherMethods != nil {
+			return route.otherMethods, vars
+		}
+	}
+	return nil, nil
+}
+
+// isUnknownMethod reports whether the method is neither one of the
+// StandardMethods nor registered for any path.
+func (r *Router) isUnknownMethod(method string) bool {
+	if IsStandardMethod(method) {
+		return false
+	}
+	i := sort.SearchStrings(r.methods, method)
+	return i == len(r.methods) || r.methods[i] != method
+}
+
+// allowed returns the methods to answer a request with "405 Method Not Allowed"
+// for, or nil if the request is to be handled as not found.
+func (r *Router) allowed(path string) []string {
+	if r.HideMethodNotAllowed {
+		return nil
+	}
+	return r.Allowed(path)
+}
+
+// TreeJSON returns the routing tree as a JSON document for debugging tools.
+// Each node is an object with its path, the first bytes of the paths of its
+// static children ("indices"), its type ("static", "param" or "catchAll"),
+// the methods of its handles and its children, e.g.:
+//
+//	{"path":"/","nType":"static","methods":["GET"],"children":[...]}
+func (r *Router) TreeJSON() ([]byte, error) {
+	r.Compile()
+	return json.Marshal(r.node.toJSON())
+}
+
+// TrailingSlashConflicts returns the sorted paths which are registered both
+// without and with a trailing slash, e.g. "/foo" if "/foo" and "/foo/" are
+// registered, as long as the router redirects requests because of trailing
+// slashes. Such routes are a common mistake: with a TrailingSlashPolicy one of
+// them is unreachable, with RedirectTrailingSlash only, whether a client is
+// redirected depends on the method it uses.
+// It returns nil if RedirectTrailingSlash is disabled and the
+// TrailingSlashPolicy is TrailingSlashAsIs.
+func (r *Router) TrailingSlashConflicts() []string {
+	if !r.RedirectTrailingSlash && r.TrailingSlashPolicy == TrailingSlashAsIs {
+		return nil
+	}
+
+	r.Compile()
+	paths := make(map[string]bool)
+	r.node.walk("", func(path string, n *node) {
+		if n.handle.len() > 0 {
+			paths[path] = true
+		}
+	})
+
+	var conflicts []string
+	for path := range paths {
+		if path != "/" && path[len(path)-1] != '/' && paths[path+"/"] {
+			conflicts = append(conflicts, path)
+		}
+	}
+	sort.Strings(conflicts)
+	return conflicts
+}
+
+// Routes returns the registered routes sorted by path and method, including
+// all candidate routes registered for the same method and path (see
+// Route.When). A route registered for several paths, e.g. with defaults, is
+// returned once.
+func (r *Router) Routes() []Route {
+	r.Compile()
+	var routes []Route
+	seen := make(map[*Route]bool)
+	r.node.walk("", func(_ string, n *node) {
+		for _, method := range n.handle.methods() {
+			for route := n.handle.get(method); route != nil; route = route.alt {
+				if !seen[route] {
+					seen[route] = true
+					routes = append(routes, *route)
+				}
+			}
+		}
+	})
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// RoutesByTag returns the routes with the tag, like Routes.
+func (r *Router) RoutesByTag(tag string) []Route {
+	var tagged []Route
+	for _, route := range r.Routes() {
+		if route.HasTag(tag) {
+			tagged = append(tagged, route)
+		}
+	}
+	return tagged
+}
+
+// NumRoutes returns the total number of handles registered with the router,
+// i.e. the number of method and path combinations.
+func (r *Router) NumRoutes() int {
+	r.Compile()
+	routes, _ := r.countRoutes()
+	return routes
+}
+
+// TreeMetrics describes the size of the routing tree of a router.
+type TreeMetrics struct {
+	// The number of nodes of the tree.
+	Nodes int
+
+	// The number of registered handles, like NumRoutes.
+	Handles int
+
+	// The number of nodes on the longest path from the root to a leaf.
+	MaxDepth int
+
+	// The approximate number of bytes used by the nodes of the tree. It
+	// doesn't include the registered routes and their handles.
+	Bytes int
+}
+
+// Metrics returns the metrics of the routing tree, e.g. to monitor its growth
+// as routes are registered dynamically.
+func (r *Router) Metrics() TreeMetrics {
+	r.Compile()
+	return r.node.metrics()
+}
+
+// MaxParams returns the maximum number of wildcards in a registered path.
+func (r *Router) MaxParams() int {
+	r.Compile()
+	_, maxParams := r.countRoutes()
+	return maxParams
+}
+
+// PanicContext describes a panic recovered by the Router.
+type PanicContext struct {
+	// The value recovered from the panic.
+	Recovered interface{}
+
+	// The registered path pattern and the wildcard values of the route whose
+	// handle panicked. Pattern is empty if the panic didn't occur in a handle,
+	// e.g. in the NotFound handler.
+	Pattern string
+	Vars    map[string]string
+}
+
+// recovers reports whether the router recovers panics.
+func (r *Router) recovers() bool {
+	return r.PanicHandler != nil || r.PanicHandlerWithContext != nil
+}
+
 func (r *Router) recv(w http.ResponseWriter, req *http.Request) {
 	if rcv := recover(); rcv != nil {
-		r.PanicHandler(w, req, rcv)
+		r.handlePanic(w, req, PanicContext{Recovered: rcv})
+	}
+}
+
+// recvRoute is like recv, but for panics in the handle of the route, which
+// are handled by the panic handler of the route if it has one. The request
+// counts as served then.
+func (r *Router) recvRoute(w http.ResponseWriter, req *http.Request, route *Route, vars map[string]string, served *bool) {
+	if rcv := recover(); rcv != nil {
+		*served = true
+		if route.panicHandler != nil {
+			route.panicHandler(w, req, rcv)
+			return
+		}
+		r.handlePanic(w, req, PanicContext{
+			Recovered: rcv,
+			Pattern:   route.Path,
+			Vars:      vars,
+		})
+	}
+}
+
+func (r *Router) handlePanic(w http.ResponseWriter, req *http.Request, pc PanicContext) {
+	if r.PanicHandlerWithContext != nil {
+		r.PanicHandlerWithContext(w, req, pc)
+	} else if r.PanicHandler != nil {
+		r.PanicHandler(w, req, pc.Recovered)
 	}
 }
 
+// InternalServerError answers the request with "500 Internal Server Error" in
+// the ErrorFormat of the router. It can be used as PanicHandler to recover
+// panics of handles without a custom error page:
+//
+//	router.PanicHandler = router.InternalServerError
+func (r *Router) InternalServerError(w http.ResponseWriter, req *http.Request, _ interface{}) {
+	r.writeError(w, req, http.StatusInternalServerError)
+}
+
+// acquire reserves a slot for a request in flight and reports whether one
+// was free. A reserved slot must be freed with release.
+func (r *Router) acquire() bool {
+	if atomic.AddInt64(&r.inFlight, 1) > int64(r.MaxConcurrent) {
+		atomic.AddInt64(&r.inFlight, -1)
+		return false
+	}
+	return true
+}
+
+// release frees the slot reserved with acquire.
+func (r *Router) release() {
+	atomic.AddInt64(&r.inFlight, -1)
+}
+
 // ServeHTTP implements the http.Handler interface.
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	if r.PanicHandler != nil {
+	if r.MaxConcurrent > 0 {
+		if !r.acquire() {
+			r.overloaded(w, req)
+			return
+		}
+		defer r.release()
+	}
+
+	if s := r.installed(); s != nil {
+		s.ServeHTTP(w, req)
+		return
+	}
+
+	req, ok := r.admit(w, req)
+	if !ok {
+		return
+	}
+
+	if r.recovers() {
 		defer r.recv(w, req)
 	}
 
+	if req.Method == "OPTIONS" && req.URL.Path == "*" {
+		// OPTIONS * is a request about the server as a whole.
+		if r.GlobalOPTIONS != nil {
+			r.GlobalOPTIONS(w, req)
+		} else {
+			w.Header().Set("Allow", strings.Join(r.serverMethods(), ", "))
+		}
+		return
+	}
+
+	hostVars, ok := r.hostVars(req)
+	if !ok {
+		r.handleNotFound(w, req)
+		return
+	}
+
+	if r.RequireHTTPS && !r.isHTTPS(req) {
+		target := "https://" + req.Host + withQuery(mountPath(req, req.URL.EscapedPath()), req)
+		r.redirect(w, req, target, permanentRedirectCode(req.Method))
+		return
+	}
+
 	path := req.URL.Path
+	if r.MergeSlashes {
+		path = mergeSlashes(path)
+	}
 
-	if handle, vars, tsr := r.getValue(req.Method, path); handle != nil {
-		handle(w, req, vars)
-	} else if tsr && r.RedirectTrailingSlash && path != "/" {
-		if path[len(path)-1] == '/' {
-			path = path[:len(path)-1]
-		} else {
-			path = path + "/"
+	if r.canonicalRoutes {
+		if cp, ok := r.canonicalRedirect(req.Method, req.URL.Path); ok {
+			r.redirect(w, req, withQuery(cp, req), permanentRedirectCode(req.Method))
+			return
+		}
+	}
+
+	if r.TrailingSlashPolicy != TrailingSlashAsIs {
+		if cp := r.TrailingSlashPolicy.apply(path); cp != path {
+			if route, _, _ := r.getValue(req.Method, cp); route != nil {
+				r.redirect(w, req, withQuery(cp, req), permanentRedirectCode(req.Method))
+				return
+			}
+		}
+	}
+
+	if route, vars, tsr, fallback := r.matchFrom(req.Method, path, 0); route != nil {
+		if r.Events != nil {
+			r.emit(EventMatched, req.Method, route.Path, req.URL.Path)
+		}
+		if !r.serveCandidates(w, req, path, route, vars, hostVars, fallback) {
+			// All candidate routes were skipped or declined the request.
+			r.handleNotFound(w, req)
 		}
+	} else if path == "/" && r.RootHandler != nil {
+		r.RootHandler(w, req, hostVars)
+	} else if tsr && r.RedirectTrailingSlash && path != "/" {
+		path = toggleTrailingSlash(path)
 
-		http.Redirect(w, req, path, http.StatusMovedPermanently)
+		if notFound := r.notFound(req.Method); r.DeferTrailingSlashRedirect && notFound != nil {
+			notFound(w, req.WithContext(context.WithValue(req.Context(), tsrKey{}, mountPath(req, path))))
+			return
+		}
+		r.redirect(w, req, withQuery(path, req), http.StatusMovedPermanently)
 		return
+	} else if h, vars := r.otherMethodsHandler(path); h != nil {
+		h.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), varsKey{}, mergeVars(vars, hostVars))))
+	} else if allowed := r.allowed(path); len(allowed) > 0 {
+		if r.UnknownMethodStatus != 0 && r.UnknownMethodStatus != http.StatusMethodNotAllowed &&
+			r.isUnknownMethod(req.Method) {
+			r.writeError(w, req, r.UnknownMethodStatus)
+			return
+		}
+
+		// Handle 405
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		if r.MethodNotAllowed != nil {
+			r.MethodNotAllowed(w, req.WithContext(context.WithValue(req.Context(), allowedKey{}, allowed)))
+		} else {
+			r.writeError(w, req, http.StatusMethodNotAllowed)
+		}
+	} else if r.spa != nil && (req.Method == "GET" || req.Method == "HEAD") {
+		r.spa.ServeHTTP(w, req)
 	} else {
 		// Handle 404
-		if r.NotFound != nil {
-			r.NotFound(w, req)
-		} else {
+		r.handleNotFound(w, req)
+	}
+}
+
+// TryServeHTTP dispatches the request to the matching route and reports
+// whether it was handled. If no route matches the request, or all matching
+// routes skip or decline it, nothing is written to w and false is returned.
+// Unlike ServeHTTP, it neither redirects nor answers unmatched requests,
+// which allows to try several routers in turn, see Chain. Requests which
+// the router answers regardless of the routes, i.e. if MaxConcurrent is
+// exceeded or during Maintenance, count as handled.
+func (r *Router) TryServeHTTP(w http.ResponseWriter, req *http.Request) bool {
+	if r.MaxConcurrent > 0 {
+		if !r.acquire() {
+			r.overloaded(w, req)
+			return true
+		}
+		defer r.release()
+	}
+
+	if s := r.installed(); s != nil {
+		return s.TryServeHTTP(w, req)
+	}
+
+	req, ok := r.admit(w, req)
+	if !ok {
+		return true
+	}
+
+	if r.recovers() {
+		defer r.recv(w, req)
+	}
+
+	hostVars, ok := r.hostVars(req)
+	if !ok {
+		return false
+	}
+
+	route, vars, _, fallback := r.matchFrom(req.Method, req.URL.Path, 0)
+	return route != nil && r.serveCandidates(w, req, req.URL.Path, route, vars, hostVars, fallback)
+}
+
+// admit applies the options of the router which apply to all requests before
+// they are routed: requests are answered during Maintenance and get their
+// RequestID. It returns the request to route, or false if the request was
+// answered already.
+func (r *Router) admit(w http.ResponseWriter, req *http.Request) (*http.Request, bool) {
+	if m := r.Maintenance; m != nil && !m.allows(req.URL.Path) {
+		r.serveMaintenance(w, req, m)
+		return req, false
+	}
+	if r.RequestID.Enabled {
+		req = r.RequestID.attach(w, req)
+	}
+	return req, true
+}
+
+// overloaded answers a request rejected because of MaxConcurrent.
+func (r *Router) overloaded(w http.ResponseWriter, req *http.Request) {
+	if r.Overloaded != nil {
+		r.Overloaded(w, req)
+	} else {
+		r.writeError(w, req, http.StatusServiceUnavailable)
+	}
+}
+
+// isHTTPS reports whether the request was made via HTTPS.
+func (r *Router) isHTTPS(req *http.Request) bool {
+	if req.TLS != nil {
+		return true
+	}
+	return r.TrustForwardedProto && strings.EqualFold(req.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// serveCandidates serves the request with the first of the candidate routes
+// beginning with route which doesn't skip or decline it and reports whether
+// the request was handled. If all candidates skip or decline the request, the
+// path is matched again from the catch-all at the offset fallback, if any.
+func (r *Router) serveCandidates(w http.ResponseWriter, req *http.Request, path string, route *Route, vars, hostVars map[string]string, fallback int) bool {
+	for route != nil {
+		vars = mergeVars(vars, hostVars)
+		for candidate := route; candidate != nil; candidate = candidate.alt {
+			if candidate.when != nil && !candidate.when(req) {
+				continue
+			}
+			if r.serve(w, req, candidate, vars) {
+				return true
+			}
+		}
+		if fallback == 0 {
+			break
+		}
+		route, vars, _, fallback = r.matchFrom(req.Method, path, fallback)
+	}
+	return false
+}
+
+// serve invokes the handle of the matched route and reports whether the
+// request was handled, i.e. it wasn't declined by a NextHandle.
+func (r *Router) serve(w http.ResponseWriter, req *http.Request, route *Route, vars map[string]string) (served bool) {
+	if route.rateLimit != nil && !route.rateLimit(w, req) {
+		r.writeError(w, req, http.StatusTooManyRequests)
+		return true
+	}
+	if !route.consumesContentType(req.Header.Get("Content-Type")) {
+		r.writeError(w, req, http.StatusUnsupportedMediaType)
+		return true
+	}
+	if code := route.checkBody(req); code != 0 {
+		r.writeError(w, req, code)
+		return true
+	}
+	if code := route.validate(req); code != 0 {
+		r.writeError(w, req, code)
+		return true
+	}
+	if route.maxBodySize > 0 && req.Body != nil {
+		limited := *req
+		limited.Body = http.MaxBytesReader(w, req.Body, route.maxBodySize)
+		req = &limited
+	}
+	if r.ExposeAllowedMethods || r.EmitLinkHeader {
+		allowed := r.Allowed(req.URL.Path)
+		if r.ExposeAllowedMethods {
+			req = req.WithContext(context.WithValue(req.Context(), allowedKey{}, allowed))
+		}
+		if r.EmitLinkHeader {
+			// A declined candidate route may have added the header already.
+			if link := linkHeader(mountPath(req, req.URL.EscapedPath()), allowed); !headerHasValue(w.Header(), "Link", link) {
+				w.Header().Add("Link", link)
+			}
+		}
+	}
+	if r.PanicHandlerWithContext != nil || route.panicHandler != nil {
+		defer r.recvRoute(w, req, route, vars, &served)
+	}
+	var gw *gzipResponseWriter
+	if route.gzip {
+		if !headerHasToken(w.Header(), "Vary", "Accept-Encoding") {
+			w.Header().Add("Vary", "Accept-Encoding")
+		}
+		if acceptsGzip(req) {
+			gw = newGzipResponseWriter(w, route.gzipMinSize)
+			w = gw
+		}
+	}
+	if route.cacheControl != "" {
+		w.Header().Set("Cache-Control", route.cacheControl)
+	}
+	var nw *noContentWriter
+	if route.noContent {
+		nw = &noContentWriter{ResponseWriter: w}
+		w = nw
+	}
+
+	// The flag is only allocated for routes with a NextHandle, handles of
+	// other routes are called without allocations.
+	handle := route.Handle
+	var declined *bool
+	if route.nextHandle != nil {
+		declined = new(bool)
+		handle = declinable(route.nextHandle, declined)
+	}
+	timedOut := false
+	if timeout := r.handlerTimeout(route); timeout > 0 {
+		invoke := func(w http.ResponseWriter, req *http.Request) {
+			r.applyMiddleware(route, req.Method, handle)(w, req, vars)
+		}
+		timedOut = !r.serveTimeout(w, req, timeout, invoke)
+	} else {
+		r.applyMiddleware(route, req.Method, handle)(w, req, vars)
+	}
+	served = true
+	switch {
+	case timedOut:
+		// The timeout response is written already.
+	case declined != nil && *declined:
+		if route.cacheControl != "" {
+			// The next candidate or the NotFound handler answers the request.
+			w.Header().Del("Cache-Control")
+		}
+		served = false
+	case nw != nil && !nw.written:
+		nw.ResponseWriter.WriteHeader(http.StatusNoContent)
+	}
+	if gw != nil {
+		// Not deferred, the buffered response of a panicking handle must
+		// not be flushed before the panic handler answers the request.
+		gw.Close()
+	}
+	return served
+}
+
+// declinable returns a Handle calling the NextHandle, which sets declined if
+// the NextHandle calls next.
+func declinable(handle NextHandle, declined *bool) Handle {
+	return func(w http.ResponseWriter, req *http.Request, vars map[string]string) {
+		handle(w, req, vars, func() {
+			*declined = true
+		})
+	}
+}
+
+func (r *Router) handleNotFound(w http.ResponseWriter, req *http.Request) {
+	if r.Events != nil {
+		r.emit(EventNotFound, req.Method, "", req.URL.Path)
+	}
+	if notFound := r.notFound(req.Method); notFound != nil {
+		notFound(w, req)
+	} else if cp, ok := cleanPathRedirect(req); ok {
+		r.redirect(w, req, withQuery(cp, req), permanentRedirectCode(req.Method))
+	} else {
+		r.writeError(w, req, http.StatusNotFound)
+	}
+}
+
+// canonicalRedirect returns the canonical path to redirect a request for the
+// path to, if a route with Canonical matches it and it differs from the path.
+func (r *Router) canonicalRedirect(method, path string) (string, bool) {
+	if route, _, _ := r.getValue(method, path); route != nil && !route.canonical {
+		// A route registered for the path as it is takes precedence.
+		return "", false
+	}
+
+	// Lowercasing only ASCII letters keeps the offsets of the bytes, thus the
+	// wildcard values can be taken from the path as it is.
+	orig := CleanPath(path)
+	cp := lowerASCII(orig)
+	route, vars, tsr := r.getValue(method, cp)
+	if route == nil && tsr && cp != "/" {
+		cp, orig = toggleTrailingSlash(cp), toggleTrailingSlash(orig)
+		route, vars, _ = r.getValue(method, cp)
+	}
+	if route == nil || !route.canonical {
+		return "", false
+	}
+	// Routes registered for both slashes are canonical without the slash of
+	// the variant they are registered for too.
+	if cp != "/" && !strings.Contains(route.Path, "*") &&
+		strings.HasSuffix(cp, "/") != strings.HasSuffix(route.Path, "/") {
+		cp, orig = toggleTrailingSlash(cp), toggleTrailingSlash(orig)
+	}
+	cp = canonicalPath(route.Path, cp, orig, vars)
+	return cp, cp != path
+}
+
+// canonicalPath returns the lowercased path lower of a request matched by the
+// pattern, but with the values of the wildcards taken from orig, the path
+// before lowercasing. Thus only the static parts of the path are lowercased.
+func canonicalPath(pattern, lower, orig string, vars map[string]string) string {
+	var b strings.Builder
+	j := 0
+	for i := 0; i < len(pattern) && j < len(lower); i++ {
+		switch c := pattern[i]; c {
+		case ':':
+			k := i + 1
+			for k < len(pattern) && isNameChar(pattern[k]) {
+				k++
+			}
+			n := len(vars[pattern[i+1:k]])
+			if k < len(pattern) && pattern[k] == '+' {
+				k++
+			}
+			if j+n > len(orig) {
+				// The value is a default, which is not part of the path.
+				return lower
+			}
+			b.WriteString(orig[j : j+n])
+			j += n
+			i = k - 1
+		case '*':
+			// The '/' the value begins with is written already.
+			b.WriteString(orig[j:])
+			j = len(orig)
+		default:
+			if lower[j] != c {
+				return lower
+			}
+			b.WriteByte(c)
+			j++
+		}
+	}
+	b.WriteString(lower[j:])
+	return b.String()
+}
+
+// lowerASCII returns s with all ASCII letters mapped to lower case. Unlike
+// strings.ToLower, the length of s is kept.
+func lowerASCII(s string) string {
+	for i := 0; i < len(s); i++ {
+		if 'A' <= s[i] && s[i] <= 'Z' {
+			b := []byte(s)
+			for ; i < len(b); i++ {
+				if 'A' <= b[i] && b[i] <= 'Z' {
+					b[i] += 'a' - 'A'
+				}
+			}
+			return string(b)
+		}
+	}
+	return s
+}
+
+// notFound returns the custom NotFound handler for requests with the method,
+// which is the one of NotFoundByMethod if there is one. It returns nil for
+// the NotFound func of this package, whose requests the router handles
+// itself.
+func (r *Router) notFound(method string) http.HandlerFunc {
+	h := r.NotFound
+	if mh, ok := r.NotFoundByMethod[method]; ok && mh != nil {
+		h = mh
+	}
+	if h != nil && reflect.ValueOf(h).Pointer() == notFoundFunc {
+		return nil
+	}
+	return h
+}
+
+// notFoundFunc is the address of the NotFound func of this package.
+var notFoundFunc = reflect.ValueOf(NotFound).Pointer()
+
+// redirect redirects the request to the target, either with the
+// RedirectHandler or with the http status code.
+func (r *Router) redirect(w http.ResponseWriter, req *http.Request, target string, code int) {
+	if strings.HasPrefix(target, "/") {
+		target = mountPath(req, target)
+	}
+	if r.RedirectHandler != nil {
+		r.RedirectHandler(w, req, target)
+		return
+	}
+	http.Redirect(w, req, target, code)
+}
+
+// writeError writes an error response with the http status code in the
+// ErrorFormat of the router.
+func (r *Router) writeError(w http.ResponseWriter, req *http.Request, code int) {
+	if r.ErrorFormat != ErrorJSON {
+		if code == http.StatusNotFound {
 			http.NotFound(w, req)
+		} else {
+			http.Error(w, http.StatusText(code), code)
 		}
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(struct {
+		Error  string `json:"error"`
+		Status int    `json:"status"`
+	}{http.StatusText(code), code})
 }
@@ -4,11 +4,18 @@
 package httprouter
 
 import (
+	"context"
 	"errors"
+	"mime"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"unsafe"
 )
 
 type mockResponseWriter struct{}
@@ -122,6 +129,35 @@ func TestRouterRoot(t *testing.T) {
 	}
 }
 
+func TestRouterAutoPrefixSlash(t *testing.T) {
+	var got map[string]string
+	handle := func(_ http.ResponseWriter, _ *http.Request, vars map[string]string) {
+		got = vars
+	}
+
+	router := New()
+	router.AutoPrefixSlash = true
+	router.GET("users/:id", handle)
+
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest("GET", "/users/42", nil)
+	router.ServeHTTP(w, r)
+	if got["id"] != "42" {
+		t.Errorf("routing path registered without leading slash failed: vars=%v", got)
+	}
+	if route, _, _ := router.getValue("GET", "/users/42"); route == nil || route.Path != "/users/:id" {
+		t.Errorf("route not registered with leading slash")
+	}
+
+	router = New()
+	recv := catchPanic(func() {
+		router.GET("users/:id", handle)
+	})
+	if recv == nil {
+		t.Errorf("registering path not beginning with '/' did not panic without AutoPrefixSlash")
+	}
+}
+
 func TestRouterNotFound(t *testing.T) {
 	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
 
@@ -164,6 +200,352 @@ func TestRouterNotFound(t *testing.T) {
 	}
 }
 
+func TestRouterNotFoundByMethod(t *testing.T) {
+	router := New()
+	router.GET("/dir/", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {})
+	router.DeferTrailingSlashRedirect = true
+
+	var got string
+	handlerFor := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, _ *http.Request) {
+			got = name
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+	router.NotFoundByMethod = map[string]http.HandlerFunc{
+		"GET":  handlerFor("page"),
+		"POST": handlerFor("api"),
+	}
+
+	tests := []struct {
+		method, path string
+		name         string
+		code         int
+	}{
+		{"GET", "/nope", "page", http.StatusNotFound},
+		{"POST", "/nope", "api", http.StatusNotFound},
+		{"GET", "/dir", "page", http.StatusNotFound},
+		{"PUT", "/nope", "", http.StatusNotFound},
+		{"PUT", "/a/../nope", "", http.StatusPermanentRedirect},
+	}
+	check := func() {
+		for _, test := range tests {
+			got = ""
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(test.method, test.path, nil)
+			router.ServeHTTP(w, req)
+			if got != test.name || w.Code != test.code {
+				t.Errorf("%s %s: want %q with code %d, got %q with code %d",
+					test.method, test.path, test.name, test.code, got, w.Code)
+			}
+		}
+	}
+	check()
+
+	// The global NotFound handler is used for other methods.
+	router.NotFound = handlerFor("global")
+	tests[3].name = "global"
+	tests[4].name, tests[4].code = "global", http.StatusNotFound
+	check()
+}
+
+func TestRouterMaxRoutes(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.MaxRoutes = 3
+	router.AllowIdenticalReregistration = true
+	router.GET("/a", handle)
+	router.POST("/a", handle)
+	router.GET("/a", handle)
+
+	// A route whose registration fails doesn't count.
+	if recv := catchPanic(func() { router.GET("/:b", handle) }); recv == nil {
+		t.Fatal("no panic for conflicting route")
+	}
+
+	router.GET("/list/:page", handle)
+	if n := router.NumRoutes(); n != 3 {
+		t.Fatalf("wrong number of routes: want 3, got %d", n)
+	}
+
+	recv := catchPanic(func() { router.GET("/b", handle) })
+	if msg, _ := recv.(string); !strings.Contains(msg, "/b") {
+		t.Errorf("want panic naming the route beyond the maximum, got %v", recv)
+	}
+	recv = catchPanic(func() { router.GET("/c", handle) })
+	if recv == nil {
+		t.Error("no panic for route beyond the maximum")
+	}
+	if route, _, _ := router.getValue("GET", "/b"); route != nil {
+		t.Error("route beyond the maximum was registered")
+	}
+
+	// The path added for a default counts as well.
+	router.MaxRoutes = 4
+	recv = catchPanic(func() { router.GET("/items/:page", handle).Default("page", "1") })
+	if recv == nil {
+		t.Error("no panic for default path beyond the maximum")
+	}
+}
+
+func TestRouterEmptyQuery(t *testing.T) {
+	routed := false
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		routed = true
+	}
+
+	router := New()
+	router.GET("/foo", handle)
+	router.GET("/dir/", handle)
+
+	req, _ := http.NewRequest("GET", "/foo?", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if !routed {
+		t.Error("routing of '/foo?' failed")
+	}
+
+	tests := []struct {
+		router   *Router
+		url      string
+		location string
+	}{
+		{router, "/foo/?", "/foo"},
+		{router, "/foo/?a=1", "/foo?a=1"},
+		{router, "/dir?", "/dir/"},
+		{router, "/dir?a=1&b=2", "/dir/?a=1&b=2"},
+		{router, "/x/../foo?", "/foo"},
+		{router, "/x/../foo?a=1", "/foo?a=1"},
+		{&Router{RequireHTTPS: true}, "http://example.com/foo?", "https://example.com/foo"},
+		{&Router{RequireHTTPS: true}, "http://example.com/foo?a=1", "https://example.com/foo?a=1"},
+		{&Router{TrailingSlashPolicy: StripTrailingSlash}, "/dir/?", "/dir"},
+	}
+	tests[len(tests)-1].router.GET("/dir", handle)
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", test.url, nil)
+		test.router.ServeHTTP(w, req)
+		if location := w.Header().Get("Location"); location != test.location {
+			t.Errorf("%s: want Location %q, got %q (code %d)", test.url, test.location, location, w.Code)
+		}
+	}
+}
+
+func TestRouterMergeSlashes(t *testing.T) {
+	var got map[string]string
+	routed := ""
+	handleFor := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, vars map[string]string) {
+			routed, got = name, vars
+		}
+	}
+
+	router := New()
+	router.MergeSlashes = true
+	router.GET("/a/b", handleFor("/a/b"))
+	router.GET("/dir/", handleFor("/dir/"))
+	router.GET("/user/:id/posts", handleFor("/user/:id/posts"))
+
+	tests := []struct {
+		path     string
+		route    string
+		vars     map[string]string
+		location string
+	}{
+		{"/a//b", "/a/b", nil, ""},
+		{"/a///b", "/a/b", nil, ""},
+		{"//a/b", "/a/b", nil, ""},
+		{"/dir//", "/dir/", nil, ""},
+		{"/user//42//posts", "/user/:id/posts", map[string]string{"id": "42"}, ""},
+		{"/a//b//", "", nil, "/a/b"},
+		{"//dir", "", nil, "/dir/"},
+	}
+
+	for _, test := range tests {
+		routed, got = "", nil
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.URL.Path = test.path // a leading "//" would be parsed as a host
+		router.ServeHTTP(w, req)
+		if routed != test.route || !reflect.DeepEqual(got, test.vars) {
+			t.Errorf("%s: want route %q with vars %v, got %q with %v", test.path, test.route, test.vars, routed, got)
+		}
+		if location := w.Header().Get("Location"); location != test.location {
+			t.Errorf("%s: want Location %q, got %q", test.path, test.location, location)
+		}
+	}
+
+	// Without the option, the path is redirected to the clean path.
+	router.MergeSlashes = false
+	routed = ""
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/a//b", nil)
+	router.ServeHTTP(w, req)
+	if routed != "" || w.Header().Get("Location") != "/a/b" {
+		t.Errorf("want redirect to /a/b, got route %q and Location %q", routed, w.Header().Get("Location"))
+	}
+}
+
+func TestRouterEmitLinkHeader(t *testing.T) {
+	handle := func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		w.Header().Add("Link", `</docs>; rel="help"`)
+	}
+
+	router := New()
+	router.EmitLinkHeader = true
+	router.GET("/users/:id", handle)
+	router.PUT("/users/:id", handle)
+	router.DELETE("/users/:id", handle)
+	router.HandleNext("GET", "/next", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string, next func()) {
+		next()
+	}).When(func(*http.Request) bool { return true })
+	router.GET("/next", handle)
+
+	tests := []struct {
+		method, path string
+		links        []string
+	}{
+		{"GET", "/users/42", []string{
+			`</users/42>; rel="allow"; method="DELETE", </users/42>; rel="allow"; method="GET", </users/42>; rel="allow"; method="PUT"`,
+			`</docs>; rel="help"`,
+		}},
+		{"GET", "/next", []string{`</next>; rel="allow"; method="GET"`, `</docs>; rel="help"`}},
+		{"POST", "/users/42", nil},
+		{"GET", "/nope", nil},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(w, req)
+		if links := w.Header().Values("Link"); !reflect.DeepEqual(links, test.links) {
+			t.Errorf("%s %s: want Link %q, got %q", test.method, test.path, test.links, links)
+		}
+	}
+}
+
+func TestRouterCatchAllRoot(t *testing.T) {
+	var got map[string]string
+	routed := false
+	handle := func(_ http.ResponseWriter, _ *http.Request, vars map[string]string) {
+		routed, got = true, vars
+	}
+
+	router := New()
+	router.GET("/files/*filepath", handle)
+	router.POST("/static", handle)
+	router.GET("/static/*filepath", handle)
+
+	type result struct {
+		filepath string
+		location string
+	}
+	tests := []struct {
+		path    string
+		results map[CatchAllRootMode]result
+	}{
+		{"/files", map[CatchAllRootMode]result{
+			CatchAllRootRedirect: {"", "/files/"},
+			CatchAllRootEmpty:    {"", ""},
+			CatchAllRootSlash:    {"/", ""},
+		}},
+		{"/static", map[CatchAllRootMode]result{
+			CatchAllRootRedirect: {"", "/static/"},
+			CatchAllRootEmpty:    {"", ""},
+			CatchAllRootSlash:    {"/", ""},
+		}},
+		{"/files/", map[CatchAllRootMode]result{
+			CatchAllRootRedirect: {"/", ""},
+			CatchAllRootEmpty:    {"/", ""},
+			CatchAllRootSlash:    {"/", ""},
+		}},
+		{"/files/a", map[CatchAllRootMode]result{
+			CatchAllRootRedirect: {"/a", ""},
+			CatchAllRootEmpty:    {"/a", ""},
+			CatchAllRootSlash:    {"/a", ""},
+		}},
+	}
+
+	for _, mode := range []CatchAllRootMode{CatchAllRootRedirect, CatchAllRootEmpty, CatchAllRootSlash} {
+		router.CatchAllRoot = mode
+		for _, test := range tests {
+			want := test.results[mode]
+			routed, got = false, nil
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", test.path, nil)
+			router.ServeHTTP(w, req)
+
+			if location := w.Header().Get("Location"); location != want.location {
+				t.Errorf("mode %d, %s: want Location %q, got %q", mode, test.path, want.location, location)
+			}
+			if routed != (want.location == "") {
+				t.Errorf("mode %d, %s: want routed=%t, got %t", mode, test.path, want.location == "", routed)
+			} else if value, ok := got["filepath"]; routed && (!ok || value != want.filepath) {
+				t.Errorf("mode %d, %s: want filepath=%q, got %v", mode, test.path, want.filepath, got)
+			}
+		}
+	}
+
+	// The catch-all only matches methods it is registered for.
+	router.CatchAllRoot = CatchAllRootSlash
+	routed = false
+	req, _ := http.NewRequest("PUT", "/files", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if routed {
+		t.Error("PUT /files: routed to the catch-all of GET")
+	}
+}
+
+func TestRouterCatchAllRequiresSegment(t *testing.T) {
+	var got map[string]string
+	routed := false
+	handle := func(_ http.ResponseWriter, _ *http.Request, vars map[string]string) {
+		routed, got = true, vars
+	}
+
+	router := New()
+	router.GET("/download/*file", handle)
+	router.GET("/src/*filepath", handle)
+	router.GET("/src/pkg/*name", handle)
+
+	tests := []struct {
+		path     string
+		required bool
+		code     int
+		file     string
+	}{
+		{"/download/", false, http.StatusOK, "/"},
+		{"/download/", true, http.StatusNotFound, ""},
+		{"/download/a", false, http.StatusOK, "/a"},
+		{"/download/a", true, http.StatusOK, "/a"},
+		{"/download", false, http.StatusMovedPermanently, ""},
+		{"/download", true, http.StatusNotFound, ""},
+		// An empty nested catch-all falls back to the one of the parent path.
+		{"/src/pkg/", false, http.StatusOK, "/"},
+		{"/src/pkg/", true, http.StatusOK, "/pkg/"},
+	}
+
+	for _, test := range tests {
+		router.CatchAllRequiresSegment = test.required
+		routed, got = false, nil
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", test.path, nil)
+		router.ServeHTTP(w, req)
+
+		if w.Code != test.code || routed != (test.code == http.StatusOK) {
+			t.Errorf("required=%t, %s: want status %d, got %d (routed=%t)", test.required, test.path, test.code, w.Code, routed)
+			continue
+		}
+		var value string
+		for _, v := range got {
+			value = v
+		}
+		if routed && (len(got) != 1 || value != test.file) {
+			t.Errorf("required=%t, %s: want catch-all value %q, got %v", test.required, test.path, test.file, got)
+		}
+	}
+}
 func TestRouterPanicHandler(t *testing.T) {
 	router := New()
 	panicHandled := false
@@ -192,6 +574,46 @@ func TestRouterPanicHandler(t *testing.T) {
 	}
 }
 
+func TestRouterPanicHandlerWithContext(t *testing.T) {
+	router := New()
+
+	var got PanicContext
+	router.PanicHandlerWithContext = func(w http.ResponseWriter, _ *http.Request, pc PanicContext) {
+		got = pc
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	router.PanicHandler = func(_ http.ResponseWriter, _ *http.Request, _ interface{}) {
+		t.Error("PanicHandler invoked instead of PanicHandlerWithContext")
+	}
+
+	router.Handle("PUT", "/user/:name", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		panic("oops!")
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/user/gopher", nil)
+	router.ServeHTTP(w, req)
+
+	if got.Recovered != "oops!" || got.Pattern != "/user/:name" ||
+		!reflect.DeepEqual(got.Vars, map[string]string{"name": "gopher"}) {
+		t.Errorf("wrong panic context: %+v", got)
+	}
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("wrong status code: want 500, got %d", w.Code)
+	}
+
+	// Panics outside of handles have no pattern.
+	got = PanicContext{}
+	router.NotFound = func(_ http.ResponseWriter, _ *http.Request) {
+		panic("not found")
+	}
+	req, _ = http.NewRequest("GET", "/nope", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if got.Recovered != "not found" || got.Pattern != "" || got.Vars != nil {
+		t.Errorf("wrong panic context for NotFound: %+v", got)
+	}
+}
+
 type mockFileSystem struct {
 	opened bool
 }
@@ -221,3 +643,1900 @@ func TestRouterFiles(t *testing.T) {
 		t.Error("serving file failed")
 	}
 }
+
+func TestRouterRateLimit(t *testing.T) {
+	router := New()
+
+	routed := false
+	allow := true
+	router.GET("/limited", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		routed = true
+	}).RateLimit(func(_ http.ResponseWriter, _ *http.Request) bool {
+		return allow
+	})
+
+	r, _ := http.NewRequest("GET", "/limited", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !routed || w.Code != http.StatusOK {
+		t.Errorf("allowed request not routed: routed=%t, Code=%d", routed, w.Code)
+	}
+
+	routed = false
+	allow = false
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if routed {
+		t.Error("denied request was routed")
+	}
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("wrong status code for denied request: want %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+}
+
+func TestRouterIdenticalReregistration(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+	paths := []string{
+		"/",
+		"/user/:name",
+		"/src/*filepath",
+	}
+
+	router := New()
+	router.AllowIdenticalReregistration = true
+	// The pattern is looked up as it is, not matched like a request path.
+	router.MaxParamLength = 3
+	for _, path := range paths {
+		first := router.GET(path, handle)
+		var second *Route
+		recv := catchPanic(func() {
+			second = router.GET(path, handle)
+		})
+		if recv != nil {
+			t.Errorf("panic while re-registering route '%s': %v", path, recv)
+		} else if second != first {
+			t.Errorf("re-registering route '%s' didn't return the registered route", path)
+		}
+	}
+
+	recv := catchPanic(func() {
+		router.GET("/user/:id", handle)
+	})
+	if recv == nil {
+		t.Error("no panic while registering conflicting route '/user/:id'")
+	}
+
+	router = New()
+	for _, path := range paths {
+		router.GET(path, handle)
+		recv := catchPanic(func() {
+			router.GET(path, handle)
+		})
+		if recv == nil {
+			t.Errorf("no panic while re-registering route '%s'", path)
+		}
+	}
+}
+
+func TestRouterContextVars(t *testing.T) {
+	router := New()
+
+	var got map[string]string
+	handle := func(_ http.ResponseWriter, _ *http.Request, vars map[string]string) {
+		got = vars
+	}
+	router.HandlerFunc("GET", "/user/:name", WrapHandle(handle))
+	router.HandlerFunc("GET", "/static", WrapHandle(handle))
+	router.GETFunc("/func/:name", handle)
+
+	tests := []struct {
+		path string
+		vars map[string]string
+	}{
+		{"/user/gopher", map[string]string{"name": "gopher"}},
+		{"/static", nil},
+		{"/func/gopher", map[string]string{"name": "gopher"}},
+	}
+
+	for _, test := range tests {
+		got = nil
+		w := new(mockResponseWriter)
+		req, _ := http.NewRequest("GET", test.path, nil)
+		router.ServeHTTP(w, req)
+		if !reflect.DeepEqual(got, test.vars) {
+			t.Errorf("wrong vars for path '%s': want %v, got %v", test.path, test.vars, got)
+		}
+	}
+}
+
+func TestRouterTrailingSlashPolicy(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.GET("/", handlerFunc)
+	router.GET("/both", handlerFunc)
+	router.GET("/both/", handlerFunc)
+	router.GET("/slash/", handlerFunc)
+	router.GET("/noslash", handlerFunc)
+	router.POST("/form/", handlerFunc)
+
+	testRoutes := []struct {
+		policy   TrailingSlashPolicy
+		method   string
+		route    string
+		code     int
+		location string
+	}{
+		{TrailingSlashAsIs, "GET", "/both", 200, ""},
+		{TrailingSlashAsIs, "GET", "/both/", 200, ""},
+		{AddTrailingSlash, "GET", "/both", 301, "/both/"},
+		{AddTrailingSlash, "GET", "/both/", 200, ""},
+		{AddTrailingSlash, "GET", "/slash", 301, "/slash/"},
+		{AddTrailingSlash, "GET", "/noslash", 200, ""},
+		{AddTrailingSlash, "GET", "/", 200, ""},
+		{StripTrailingSlash, "GET", "/both", 200, ""},
+		{StripTrailingSlash, "GET", "/both/", 301, "/both"},
+		{StripTrailingSlash, "GET", "/noslash/", 301, "/noslash"},
+		{StripTrailingSlash, "GET", "/slash/", 200, ""},
+		{StripTrailingSlash, "GET", "/nope/", 404, ""},
+		{AddTrailingSlash, "HEAD", "/slash", 301, "/slash/"},
+		{AddTrailingSlash, "POST", "/form", 308, "/form/"},
+	}
+
+	for _, tr := range testRoutes {
+		router.TrailingSlashPolicy = tr.policy
+		r, _ := http.NewRequest(tr.method, tr.route, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tr.code || w.Header().Get("Location") != tr.location {
+			t.Errorf("trailing slash policy %d for %s %s failed: Code=%d, Header=%v", tr.policy, tr.method, tr.route, w.Code, w.Header())
+		}
+	}
+}
+
+func TestRouterNumRoutes(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	if n, m := router.NumRoutes(), router.MaxParams(); n != 0 || m != 0 {
+		t.Errorf("wrong counts for empty router: NumRoutes=%d, MaxParams=%d", n, m)
+	}
+
+	router.GET("/", handlerFunc)
+	router.GET("/user/:name", handlerFunc)
+	router.POST("/user/:name", handlerFunc)
+	router.GET("/user/:name/files/*filepath", handlerFunc)
+	router.GET("/cmd/:tool/:sub", handlerFunc)
+	router.PUT("/src/*filepath", handlerFunc)
+
+	if n := router.NumRoutes(); n != 6 {
+		t.Errorf("wrong NumRoutes: want 6, got %d", n)
+	}
+	if m := router.MaxParams(); m != 2 {
+		t.Errorf("wrong MaxParams: want 2, got %d", m)
+	}
+}
+
+func TestRouterMetrics(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.GET("/", handlerFunc)
+	router.GET("/users", handlerFunc)
+	router.POST("/users", handlerFunc)
+	router.GET("/users/:id", handlerFunc)
+	router.GET("/users/:id/posts", handlerFunc)
+	router.GET("/files/*filepath", handlerFunc)
+
+	// The tree is:
+	//	/
+	//	├ users
+	//	│ └ /
+	//	│   └ :id
+	//	│     └ /posts
+	//	└ files/
+	//	  └ *filepath
+	m := router.Metrics()
+	if m.Nodes != 7 || m.Handles != 6 || m.MaxDepth != 5 {
+		t.Errorf("wrong metrics: want Nodes=7, Handles=6, MaxDepth=5, got %+v", m)
+	}
+	if min := 7 * int(unsafe.Sizeof(node{})); m.Bytes < min {
+		t.Errorf("wrong Bytes: want at least %d, got %d", min, m.Bytes)
+	}
+
+	router.GET("/users/:id/posts/:post/comments", handlerFunc)
+	grown := router.Metrics()
+	if grown.Nodes != 10 || grown.Handles != 7 || grown.MaxDepth != 8 || grown.Bytes <= m.Bytes {
+		t.Errorf("wrong metrics after growth: got %+v, before %+v", grown, m)
+	}
+
+	if m := New().Metrics(); m.Nodes != 1 || m.Handles != 0 || m.MaxDepth != 1 {
+		t.Errorf("wrong metrics for an empty router: %+v", m)
+	}
+}
+
+func TestRouterFilesNoDirListing(t *testing.T) {
+	fs := http.FS(fstest.MapFS{
+		"assets/app.js":       {Data: []byte("app")},
+		"docs/index.html":     {Data: []byte("index")},
+		"docs/guide/intro.md": {Data: []byte("intro")},
+	})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/files/assets/app.js", 200, "app"},
+		{"/files/docs/", 200, "index"},
+		{"/files/assets/", 404, ""},
+		{"/files/docs/guide/", 404, ""},
+		{"/files/nope", 404, ""},
+	}
+
+	router := New()
+	router.ServeFilesWithOptions("/files/*filepath", fs, ServeFilesOptions{NoDirListing: true})
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || !strings.Contains(w.Body.String(), test.body) {
+			t.Errorf("serving '%s' failed: Code=%d, Body=%q", test.path, w.Code, w.Body.String())
+		}
+		if strings.Contains(w.Body.String(), "<a href") {
+			t.Errorf("directory listing for '%s': %q", test.path, w.Body.String())
+		}
+	}
+
+	router = New()
+	router.ServeFiles("/files/*filepath", fs)
+	r, _ := http.NewRequest("GET", "/files/assets/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "app.js") {
+		t.Errorf("expected directory listing: Code=%d, Body=%q", w.Code, w.Body.String())
+	}
+}
+
+func TestRouterAllowedMethods(t *testing.T) {
+	var got []string
+	handle := func(_ http.ResponseWriter, r *http.Request, _ map[string]string) {
+		got = AllowedMethodsFromContext(r.Context())
+	}
+
+	router := New()
+	router.PUT("/user/:name", handle)
+	router.GET("/user/:name", handle)
+	router.DELETE("/user/:name", handle)
+	router.POST("/user", handle)
+	router.GET("/src/*filepath", handle)
+
+	tests := []struct {
+		path    string
+		allowed []string
+	}{
+		{"/user/gopher", []string{"DELETE", "GET", "PUT"}},
+		{"/user", []string{"POST"}},
+		{"/src/some/file", []string{"GET"}},
+		{"/nope", nil},
+	}
+
+	for _, test := range tests {
+		if allowed := router.Allowed(test.path); !reflect.DeepEqual(allowed, test.allowed) {
+			t.Errorf("wrong allowed methods for path '%s': want %v, got %v", test.path, test.allowed, allowed)
+		}
+	}
+
+	w := new(mockResponseWriter)
+	req, _ := http.NewRequest("GET", "/user/gopher", nil)
+	router.ServeHTTP(w, req)
+	if got != nil {
+		t.Errorf("allowed methods in context although disabled: %v", got)
+	}
+
+	router.ExposeAllowedMethods = true
+	for _, test := range tests[:3] {
+		got = nil
+		req, _ := http.NewRequest(test.allowed[0], test.path, nil)
+		router.ServeHTTP(w, req)
+		if !reflect.DeepEqual(got, router.Allowed(test.path)) {
+			t.Errorf("wrong allowed methods in context for path '%s': want %v, got %v", test.path, test.allowed, got)
+		}
+	}
+}
+
+func TestRouterNotFoundMethodRedirect(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	for _, method := range []string{"GET", "HEAD", "POST", "PUT"} {
+		router.Handle(method, "/api/resource", handlerFunc)
+	}
+
+	testRoutes := []struct {
+		method string
+		route  string
+		code   int
+	}{
+		{"GET", "/api//resource", http.StatusMovedPermanently},
+		{"HEAD", "/api//resource", http.StatusMovedPermanently},
+		{"POST", "/api//resource", http.StatusPermanentRedirect},
+		{"PUT", "/api//resource", http.StatusPermanentRedirect},
+		{"PUT", "/api/./resource", http.StatusPermanentRedirect},
+		{"DELETE", "/api//resource", http.StatusPermanentRedirect},
+	}
+
+	for _, tr := range testRoutes {
+		r, _ := http.NewRequest(tr.method, tr.route, strings.NewReader("body"))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != tr.code || w.Header().Get("Location") != "/api/resource" {
+			t.Errorf("redirecting %s %s failed: Code=%d, Header=%v", tr.method, tr.route, w.Code, w.Header())
+		}
+	}
+}
+
+func TestRouterParamSeparators(t *testing.T) {
+	var got map[string]string
+	handle := func(_ http.ResponseWriter, _ *http.Request, vars map[string]string) {
+		got = vars
+	}
+
+	router := New()
+	router.ParamSeparators = "."
+	router.GET("/metrics/:group", handle)
+	router.GET("/metrics/:group.:name", handle)
+	router.GET("/metrics/:group.:name.:stat", handle)
+	router.GET("/metrics/:group/raw", handle)
+	router.GET("/files/:name.json", handle)
+
+	tests := []struct {
+		path string
+		code int
+		vars map[string]string
+	}{
+		{"/metrics/cpu", 200, map[string]string{"group": "cpu"}},
+		{"/metrics/cpu.load", 200, map[string]string{"group": "cpu", "name": "load"}},
+		{"/metrics/cpu.load.avg", 200, map[string]string{"group": "cpu", "name": "load", "stat": "avg"}},
+		{"/metrics/cpu/raw", 200, map[string]string{"group": "cpu"}},
+		{"/metrics/cpu.load.avg.max", 404, nil},
+		{"/metrics/cpu.", 404, nil},
+		{"/files/report.json", 200, map[string]string{"name": "report"}},
+		{"/files/report.xml", 404, nil},
+	}
+
+	for _, test := range tests {
+		got = nil
+		r, _ := http.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || !reflect.DeepEqual(got, test.vars) {
+			t.Errorf("routing '%s' failed: Code=%d, vars=%v", test.path, w.Code, got)
+		}
+	}
+
+	router = New()
+	router.GET("/metrics/:metric", handle)
+	r, _ := http.NewRequest("GET", "/metrics/cpu.load.avg", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if got["metric"] != "cpu.load.avg" {
+		t.Errorf("wrong vars without separators: %v", got)
+	}
+}
+
+func TestRouterRedirect(t *testing.T) {
+	router := New()
+	router.Redirect("GET", "/old/:id", "/new/:id", http.StatusMovedPermanently)
+	router.Redirect("POST", "/old/:id", "/new/:id", http.StatusPermanentRedirect)
+	router.Redirect("GET", "/user/:name/files/*filepath", "/files/:name/*filepath", http.StatusFound)
+	router.Redirect("GET", "/home", "/", http.StatusMovedPermanently)
+	router.Redirect("GET", "/x/*rest", "/*rest", http.StatusMovedPermanently)
+
+	tests := []struct {
+		method   string
+		path     string
+		code     int
+		location string
+	}{
+		{"GET", "/old/42", 301, "/new/42"},
+		{"GET", "/old/42?page=2&sort=asc", 301, "/new/42?page=2&sort=asc"},
+		{"POST", "/old/42", 308, "/new/42"},
+		{"GET", "/user/gopher/files/a/b.txt", 302, "/files/gopher/a/b.txt"},
+		{"GET", "/home", 301, "/"},
+		{"GET", "/x//evil.com", 301, "/evil.com"},
+		{"GET", "/x///evil.com/a", 301, "/evil.com/a"},
+		{"GET", "/x/a%3Fb", 301, "/a%3Fb"},
+		{"GET", "/x/a%23b/c d", 301, "/a%23b/c%20d"},
+		{"GET", "/old/a%3Fb c", 301, "/new/a%3Fb%20c"},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, "/", nil)
+		// Set the path directly, NewRequest would parse "//evil.com" as host.
+		r.URL.Path, _ = url.PathUnescape(strings.SplitN(test.path, "?", 2)[0])
+		if i := strings.IndexByte(test.path, '?'); i >= 0 {
+			r.URL.RawQuery = test.path[i+1:]
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("Location") != test.location {
+			t.Errorf("redirecting %s %s failed: Code=%d, Header=%v", test.method, test.path, w.Code, w.Header())
+		}
+	}
+
+	var target string
+	router.RedirectHandler = func(w http.ResponseWriter, r *http.Request, newPath string) {
+		target = newPath
+		http.Redirect(w, r, newPath, http.StatusFound)
+	}
+	r, _ := http.NewRequest("GET", "/old/42?page=2", nil)
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if target != "/new/42?page=2" {
+		t.Errorf("RedirectHandler not used for Redirect: target=%q", target)
+	}
+}
+
+func TestRouterHandleNext(t *testing.T) {
+	router := New()
+
+	routed := false
+	router.HandleNext("GET", "/user/:name", func(w http.ResponseWriter, _ *http.Request, vars map[string]string, next func()) {
+		if vars["name"] == "admin" {
+			next()
+			return
+		}
+		routed = true
+	})
+
+	notFound := false
+	router.NotFound = func(_ http.ResponseWriter, _ *http.Request) {
+		notFound = true
+	}
+
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest("GET", "/user/gopher", nil)
+	router.ServeHTTP(w, r)
+	if !routed || notFound {
+		t.Errorf("handling request failed: routed=%t, notFound=%t", routed, notFound)
+	}
+
+	routed = false
+	r, _ = http.NewRequest("GET", "/user/admin", nil)
+	router.ServeHTTP(w, r)
+	if routed || !notFound {
+		t.Errorf("declining request failed: routed=%t, notFound=%t", routed, notFound)
+	}
+
+	// Invoking the handle directly falls through to NotFound as well.
+	notFound = false
+	route, vars, _ := router.getValue("GET", "/user/admin")
+	route.Handle(w, r, vars)
+	if !notFound {
+		t.Error("declining request via Route.Handle failed")
+	}
+}
+
+func TestRouterHandleNextCatchAll(t *testing.T) {
+	router := New()
+	router.HandleNext("GET", "/files/:name", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string, next func()) {
+		next()
+	})
+
+	var path string
+	router.GET("/files/*path", func(_ http.ResponseWriter, _ *http.Request, vars map[string]string) {
+		path = vars["path"]
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/files/x", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || path != "/x" {
+		t.Errorf("declined request not handled by the catch-all: Code=%d, path=%q", w.Code, path)
+	}
+
+	path = ""
+	if !router.TryServeHTTP(httptest.NewRecorder(), r) || path != "/x" {
+		t.Errorf("declined request not tried with the catch-all: path=%q", path)
+	}
+}
+
+func TestIsStandardMethod(t *testing.T) {
+	for _, method := range StandardMethods {
+		if !IsStandardMethod(method) {
+			t.Errorf("%s is not a standard method", method)
+		}
+	}
+
+	for _, method := range []string{"", "get", "Post", "BREW", "PROPFIND", "GET "} {
+		if IsStandardMethod(method) {
+			t.Errorf("%q is a standard method", method)
+		}
+	}
+}
+
+func TestRouterMaxParamLength(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.MaxParamLength = 8
+	router.GET("/user/:id", handlerFunc)
+	router.GET("/post/:id/comments", handlerFunc)
+	router.GET("/files/:name.:ext", handlerFunc)
+	router.GET("/src/*filepath", handlerFunc)
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/user/12345678", 200},
+		{"/user/123456789", 404},
+		{"/user/" + strings.Repeat("x", 1<<20), 404},
+		{"/post/12345678/comments", 200},
+		{"/post/123456789/comments", 404},
+		{"/files/1234.pdf", 200},
+		{"/files/12345678.pdf", 200},
+		{"/files/123456789.pdf", 404},
+		{"/files/1234.123456789", 404},
+		{"/src/" + strings.Repeat("x", 64), 200},
+	}
+
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("wrong status code for path of length %d: want %d, got %d", len(test.path), test.code, w.Code)
+		}
+	}
+
+	router.MaxParamLength = 0
+	r, _ := http.NewRequest("GET", "/user/123456789", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != 200 {
+		t.Errorf("wrong status code without limit: want 200, got %d", w.Code)
+	}
+}
+
+func TestRouterFilesExcept(t *testing.T) {
+	fs := http.FS(fstest.MapFS{
+		"index.html":    {Data: []byte("index")},
+		"assets/app.js": {Data: []byte("app")},
+		"api/x":         {Data: []byte("secret")},
+		"api/x.gz":      {Data: []byte("gzipped secret")},
+		"apiary.txt":    {Data: []byte("bees")},
+	})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/assets/app.js", 200, "app"},
+		{"/apiary.txt", 200, "bees"},
+		{"/", 200, "index"},
+		{"/api/x", 404, ""},
+		{"/api", 404, ""},
+		{"/private/key", 404, ""},
+		// NotFound redirects to the clean path, which is excluded as well.
+		{"//api/x", 301, "/api/x"},
+		{"/./api/x", 301, "/api/x"},
+		{"/assets/../api/x", 301, "/api/x"},
+		{"/assets/..//api/x", 301, "/api/x"},
+	}
+
+	for _, precompressed := range []bool{false, true} {
+		router := New()
+		router.ServeFilesWithOptions("/*filepath", fs, ServeFilesOptions{
+			Except:        []string{"/api", "/private/"},
+			Precompressed: precompressed,
+		})
+
+		for _, test := range tests {
+			r, _ := http.NewRequest("GET", "/", nil)
+			// Set the path directly, NewRequest would parse "//api/x" as host.
+			r.URL.Path = test.path
+			r.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != test.code || !strings.Contains(w.Body.String(), test.body) {
+				t.Errorf("serving '%s' (precompressed=%t) failed: Code=%d, Body=%q", test.path, precompressed, w.Code, w.Body.String())
+			}
+			if strings.Contains(w.Body.String(), "secret") {
+				t.Errorf("excluded file served for '%s' (precompressed=%t)", test.path, precompressed)
+			}
+		}
+	}
+}
+
+func TestRouterFilesPrecompressed(t *testing.T) {
+	fs := http.FS(fstest.MapFS{
+		"app.js":       {Data: []byte("plain js")},
+		"app.js.gz":    {Data: []byte("gzipped js")},
+		"style.css":    {Data: []byte("plain css")},
+		"blob.gz":      {Data: []byte("gzipped blob")},
+		"blob":         {Data: []byte("plain blob")},
+		"dir.gz/x.txt": {Data: []byte("x")},
+		"dir/x.txt":    {Data: []byte("x")},
+	})
+
+	router := New()
+	router.ServeFilesWithOptions("/static/*filepath", fs, ServeFilesOptions{Precompressed: true})
+
+	tests := []struct {
+		path     string
+		gzip     bool
+		body     string
+		encoding string
+		ctype    string
+	}{
+		{"/static/app.js", true, "gzipped js", "gzip", mime.TypeByExtension(".js")},
+		{"/static/app.js", false, "plain js", "", mime.TypeByExtension(".js")},
+		{"/static/style.css", true, "plain css", "", mime.TypeByExtension(".css")},
+		{"/static/blob", true, "gzipped blob", "gzip", "application/octet-stream"},
+		{"/static/dir", true, "", "", ""},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		if test.gzip {
+			r.Header.Set("Accept-Encoding", "gzip, deflate")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		if test.body == "" {
+			// Directories are served as they are.
+			if w.Header().Get("Content-Encoding") != "" {
+				t.Errorf("%s: directory served with Content-Encoding %q", test.path, w.Header().Get("Content-Encoding"))
+			}
+			continue
+		}
+		if w.Code != http.StatusOK || w.Body.String() != test.body {
+			t.Errorf("%s (gzip=%t): want 200 %q, got %d %q", test.path, test.gzip, test.body, w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("Content-Encoding"); got != test.encoding {
+			t.Errorf("%s (gzip=%t): wrong Content-Encoding: want %q, got %q", test.path, test.gzip, test.encoding, got)
+		}
+		if got := w.Header().Get("Content-Type"); got != test.ctype {
+			t.Errorf("%s (gzip=%t): wrong Content-Type: want %q, got %q", test.path, test.gzip, test.ctype, got)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("%s (gzip=%t): wrong Vary header: want %q, got %q", test.path, test.gzip, "Accept-Encoding", got)
+		}
+	}
+}
+
+func TestRouterRequireHTTPS(t *testing.T) {
+	routed := false
+	router := New()
+	router.RequireHTTPS = true
+	router.GET("/path", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		routed = true
+	})
+	router.POST("/path", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		routed = true
+	})
+
+	tests := []struct {
+		method   string
+		url      string
+		tls      bool
+		proto    string
+		trust    bool
+		code     int
+		location string
+	}{
+		{"GET", "http://example.com/path?q=1", false, "", false, 301, "https://example.com/path?q=1"},
+		{"POST", "http://example.com/path", false, "", false, 308, "https://example.com/path"},
+		{"GET", "https://example.com/path", true, "", false, 200, ""},
+		{"GET", "http://example.com/path", false, "https", true, 200, ""},
+		{"GET", "http://example.com/path", false, "https", false, 301, "https://example.com/path"},
+		{"GET", "http://example.com/path", false, "http", true, 301, "https://example.com/path"},
+	}
+
+	for _, test := range tests {
+		routed = false
+		router.TrustForwardedProto = test.trust
+		r := httptest.NewRequest(test.method, test.url, nil)
+		if !test.tls {
+			r.TLS = nil
+		}
+		if test.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", test.proto)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("Location") != test.location || routed != (test.code == 200) {
+			t.Errorf("%s %s (TLS=%t, X-Forwarded-Proto=%q, trusted=%t) failed: Code=%d, Header=%v, routed=%t",
+				test.method, test.url, test.tls, test.proto, test.trust, w.Code, w.Header(), routed)
+		}
+	}
+}
+
+func TestRouterMethodNotAllowed(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.POST("/path", handlerFunc)
+	router.DELETE("/path", handlerFunc)
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/path", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("wrong status code for method not allowed: want 405, got %d", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "DELETE, POST" {
+		t.Errorf("wrong Allow header: want %q, got %q", "DELETE, POST", allow)
+	}
+	if body := w.Body.String(); body != "Method Not Allowed\n" {
+		t.Errorf("wrong body: %q", body)
+	}
+
+	// A custom handler renders the body.
+	var allowed []string
+	router.MethodNotAllowed = func(w http.ResponseWriter, req *http.Request) {
+		allowed = AllowedMethodsFromContext(req.Context())
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("use " + strings.Join(allowed, " or ")))
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed || w.Body.String() != "use DELETE or POST" {
+		t.Errorf("custom handler not used: code=%d, body=%q", w.Code, w.Body.String())
+	}
+	if allow := w.Header().Get("Allow"); allow != "DELETE, POST" {
+		t.Errorf("wrong Allow header with custom handler: want %q, got %q", "DELETE, POST", allow)
+	}
+	if !reflect.DeepEqual(allowed, []string{"DELETE", "POST"}) {
+		t.Errorf("wrong allowed methods in context: %q", allowed)
+	}
+}
+
+func TestRouterHideMethodNotAllowed(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.HideMethodNotAllowed = true
+	router.POST("/path", handlerFunc)
+
+	notFound := false
+	router.NotFound = func(w http.ResponseWriter, _ *http.Request) {
+		notFound = true
+		w.WriteHeader(http.StatusNotFound)
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/path", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound || !notFound {
+		t.Errorf("wrong-method request not handled as not found: code=%d, notFound=%t", w.Code, notFound)
+	}
+	if allow := w.Header().Get("Allow"); allow != "" {
+		t.Errorf("unexpected Allow header %q", allow)
+	}
+}
+
+func TestRouterUnknownMethodStatus(t *testing.T) {
+	handlerFunc := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.UnknownMethodStatus = http.StatusNotImplemented
+	router.GET("/path", handlerFunc)
+	router.Handle("PURGE", "/cache", handlerFunc)
+
+	tests := []struct {
+		method string
+		code   int
+		allow  string
+	}{
+		{"GET", http.StatusOK, ""},
+		{"POST", http.StatusMethodNotAllowed, "GET"},
+		{"BREW", http.StatusNotImplemented, ""},
+		{"PURGE", http.StatusMethodNotAllowed, "GET"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(test.method, "/path", nil)
+		router.ServeHTTP(w, req)
+		if w.Code != test.code || w.Header().Get("Allow") != test.allow {
+			t.Errorf("%s: want %d with Allow %q, got %d with Allow %q",
+				test.method, test.code, test.allow, w.Code, w.Header().Get("Allow"))
+		}
+	}
+
+	router.UnknownMethodStatus = 0
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("BREW", "/path", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("unknown method by default: want 405, got %d", w.Code)
+	}
+}
+
+func TestRouterMaxConcurrent(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	router := New()
+	router.MaxConcurrent = 2
+	router.PanicHandler = func(w http.ResponseWriter, _ *http.Request, _ interface{}) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	router.GET("/slow", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		started <- struct{}{}
+		<-release
+	})
+	router.GET("/fast", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {})
+	router.GET("/panic", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		panic("oops")
+	})
+
+	serve := func(path string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < router.MaxConcurrent; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if code := serve("/slow"); code != http.StatusOK {
+				t.Errorf("request within the limit: want 200, got %d", code)
+			}
+		}()
+		<-started
+	}
+
+	if code := serve("/fast"); code != http.StatusServiceUnavailable {
+		t.Errorf("request above the limit: want 503, got %d", code)
+	}
+	router.Overloaded = func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}
+	if code := serve("/fast"); code != http.StatusTooManyRequests {
+		t.Errorf("request above the limit: want Overloaded handler, got %d", code)
+	}
+
+	close(release)
+	wg.Wait()
+	if code := serve("/fast"); code != http.StatusOK {
+		t.Errorf("request after the requests in flight: want 200, got %d", code)
+	}
+
+	// Requests whose handle panics free their slot as well.
+	for i := 0; i <= router.MaxConcurrent; i++ {
+		if code := serve("/panic"); code != http.StatusInternalServerError {
+			t.Errorf("panicking request: want 500, got %d", code)
+		}
+	}
+	if router.inFlight != 0 {
+		t.Errorf("want no request in flight, got %d", router.inFlight)
+	}
+}
+
+func TestRouterErrorFormatJSON(t *testing.T) {
+	router := New()
+	router.ErrorFormat = ErrorJSON
+	router.PanicHandler = router.InternalServerError
+	router.GET("/path", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {})
+	router.GET("/panic", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		panic("oops!")
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{"GET", "/nope", 404, `{"error":"Not Found","status":404}`},
+		{"POST", "/path", 405, `{"error":"Method Not Allowed","status":405}`},
+		{"GET", "/panic", 500, `{"error":"Internal Server Error","status":500}`},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s %s: want code %d, got %d", test.method, test.path, test.code, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s %s: wrong Content-Type %q", test.method, test.path, ct)
+		}
+		if body := strings.TrimSpace(w.Body.String()); body != test.body {
+			t.Errorf("%s %s: want body %s, got %s", test.method, test.path, test.body, body)
+		}
+	}
+
+	// A custom NotFound handler takes precedence.
+	router.NotFound = func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/nope", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusTeapot {
+		t.Errorf("custom NotFound handler not used: got code %d", w.Code)
+	}
+}
+
+func TestRouterStablePriorities(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+	routes := []struct{ method, path string }{
+		{"GET", "/"},
+		{"GET", "/cmd/:tool/:sub"},
+		{"GET", "/search/"},
+		{"GET", "/src/*filepath"},
+		{"POST", "/search/"},
+		{"GET", "/user_:name/about"},
+		{"GET", "/files/:dir/*filepath"},
+		{"GET", "/doc/go1.html"},
+		{"GET", "/doc/"},
+		{"GET", "/info/:user/project/:project"},
+	}
+
+	dump := func(order []int) string {
+		router := New()
+		router.StablePriorities = true
+		for _, i := range order {
+			router.Handle(routes[i].method, routes[i].path, handle)
+		}
+		return router.DumpTree()
+	}
+
+	want := dump([]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	for _, order := range [][]int{
+		{9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+		{2, 7, 4, 0, 9, 1, 5, 8, 6, 3},
+		{5, 3, 8, 2, 1, 0, 6, 4, 9, 7},
+	} {
+		if got := dump(order); got != want {
+			t.Errorf("tree depends on the insertion order %v:\nwant:\n%s\ngot:\n%s", order, want, got)
+		}
+	}
+
+	router := New()
+	router.StablePriorities = true
+	for _, route := range routes {
+		router.Handle(route.method, route.path, handle)
+	}
+	for _, route := range routes {
+		if r, _, _ := router.getValue(route.method, route.path); r == nil || r.Path != route.path {
+			t.Errorf("%s %s not matched with stable priorities", route.method, route.path)
+		}
+	}
+}
+
+func TestRouterTraversalObserver(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.GET("/", handle)
+	router.GET("/users/:id", handle)
+	router.GET("/users/:id/posts", handle)
+	router.GET("/files/*filepath", handle)
+
+	type observation struct {
+		method, path string
+		visited      int
+	}
+	var got []observation
+	router.TraversalObserver = func(method, path string, nodesVisited int) {
+		got = append(got, observation{method, path, nodesVisited})
+	}
+
+	tests := []struct {
+		path    string
+		visited int
+	}{
+		{"/", 1},               // /
+		{"/users/42", 3},       // /, users/, :id
+		{"/users/42/posts", 4}, // /, users/, :id, /posts
+		{"/files/a/b", 3},      // /, files/, *filepath
+		{"/nope", 1},           // /
+	}
+
+	for _, test := range tests {
+		got = nil
+		w := new(mockResponseWriter)
+		r, _ := http.NewRequest("GET", test.path, nil)
+		router.ServeHTTP(w, r)
+		if len(got) == 0 {
+			t.Errorf("%s: observer not called", test.path)
+			continue
+		}
+		if want := (observation{"GET", test.path, test.visited}); got[0] != want {
+			t.Errorf("%s: want observation %+v, got %+v", test.path, want, got[0])
+		}
+	}
+}
+
+func TestRouterTrailingSlashConflicts(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.GET("/foo", handle)
+	router.GET("/foo/", handle)
+	router.GET("/users/:id", handle)
+	router.POST("/users/:id/", handle)
+	router.GET("/bar/", handle)
+	router.GET("/files/*filepath", handle)
+	router.GET("/files", handle)
+
+	want := []string{"/foo", "/users/:id"}
+	if got := router.TrailingSlashConflicts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong conflicts with RedirectTrailingSlash: want %v, got %v", want, got)
+	}
+
+	router.RedirectTrailingSlash = false
+	if got := router.TrailingSlashConflicts(); got != nil {
+		t.Errorf("unexpected conflicts without trailing slash redirects: %v", got)
+	}
+
+	router.TrailingSlashPolicy = StripTrailingSlash
+	if got := router.TrailingSlashConflicts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong conflicts with StripTrailingSlash: want %v, got %v", want, got)
+	}
+}
+
+func TestRouterHandleCtx(t *testing.T) {
+	router := New()
+
+	var routed []string
+	var got map[string]string
+	handleFor := func(method string) HandleCtx {
+		return func(ctx context.Context, _ http.ResponseWriter, r *http.Request, vars map[string]string) {
+			if ctx != r.Context() {
+				t.Errorf("%s: handle not invoked with the request context", method)
+			}
+			routed = append(routed, method)
+			got = vars
+		}
+	}
+	router.GETCtx("/user/:name", handleFor("GET"))
+	router.POSTCtx("/user/:name", handleFor("POST"))
+	router.PUTCtx("/user/:name", handleFor("PUT"))
+	router.PATCHCtx("/user/:name", handleFor("PATCH"))
+	router.DELETECtx("/user/:name", handleFor("DELETE"))
+	router.HandleCtx("OPTIONS", "/user/:name", handleFor("OPTIONS"))
+
+	methods := []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	for _, method := range methods {
+		w := new(mockResponseWriter)
+		r, _ := http.NewRequest(method, "/user/gopher", nil)
+		router.ServeHTTP(w, r)
+		if got["name"] != "gopher" {
+			t.Errorf("%s: wrong vars %v", method, got)
+		}
+	}
+	if !reflect.DeepEqual(routed, methods) {
+		t.Errorf("routing failed: want %v, got %v", methods, routed)
+	}
+
+	// The cancellation of the request propagates to the handle.
+	router.GETCtx("/slow", func(ctx context.Context, _ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		<-ctx.Done()
+		if ctx.Err() != context.Canceled {
+			t.Errorf("wrong context error: %v", ctx.Err())
+		}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequestWithContext(ctx, "GET", "/slow", nil)
+	router.ServeHTTP(w, r)
+}
+
+func TestRouterPattern(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.GET("/", handle)
+	router.GET("/users", handle)
+	router.GET("/user/:id", handle)
+	router.POST("/user/:id/posts", handle)
+	router.GET("/src/*filepath", handle)
+
+	tests := []struct {
+		method  string
+		path    string
+		pattern string
+		found   bool
+	}{
+		{"GET", "/", "/", true},
+		{"GET", "/users", "/users", true},
+		{"GET", "/user/42", "/user/:id", true},
+		{"POST", "/user/42/posts", "/user/:id/posts", true},
+		{"GET", "/src/a/b.go", "/src/*filepath", true},
+		{"GET", "/user/42/posts", "", false},
+		{"GET", "/nope", "", false},
+	}
+
+	for _, test := range tests {
+		pattern, found := router.Pattern(test.method, test.path)
+		if pattern != test.pattern || found != test.found {
+			t.Errorf("Pattern(%q, %q) = %q, %t, want %q, %t",
+				test.method, test.path, pattern, found, test.pattern, test.found)
+		}
+	}
+}
+
+func TestRouterLookup(t *testing.T) {
+	routed := false
+	wantHandle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		routed = true
+	}
+
+	router := New()
+	router.GET("/user/:name", wantHandle)
+	router.GET("/dir/", wantHandle)
+	router.GET("/src/*filepath", wantHandle)
+
+	handle, vars, redirect, ok := router.Lookup("GET", "/user/gopher")
+	if !ok || redirect != "" || !reflect.DeepEqual(vars, map[string]string{"name": "gopher"}) {
+		t.Fatalf("wrong lookup result: vars=%v redirect=%q ok=%t", vars, redirect, ok)
+	}
+	handle(nil, nil, nil)
+	if !routed {
+		t.Fatal("routing failed")
+	}
+
+	tests := []struct {
+		path     string
+		redirect string
+	}{
+		{"/user/gopher/", "/user/gopher"},
+		{"/dir", "/dir/"},
+		{"/src", "/src/"},
+		{"/nope", ""},
+		{"/", ""},
+	}
+	for _, test := range tests {
+		handle, vars, redirect, ok := router.Lookup("GET", test.path)
+		if handle != nil || vars != nil || ok || redirect != test.redirect {
+			t.Errorf("Lookup(%q): want redirect %q, got handle=%t vars=%v redirect=%q ok=%t",
+				test.path, test.redirect, handle != nil, vars, redirect, ok)
+		}
+	}
+}
+
+func TestRouterMatch(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.GET("/", handle)
+	router.GET("/users", handle)
+	router.PUT("/users", handle)
+	router.GET("/user/:id", handle)
+	router.DELETE("/user/:id", handle)
+	router.GET("/src/*filepath", handle)
+	router.GET("/files/:dir+/raw", handle)
+
+	tests := []struct {
+		method string
+		path   string
+		want   Match
+	}{
+		{"GET", "/", Match{Pattern: "/", Type: StaticMatch}},
+		{"PUT", "/users", Match{Pattern: "/users", Type: StaticMatch}},
+		{"GET", "/user/42", Match{Pattern: "/user/:id", Params: map[string]string{"id": "42"}, Type: ParamMatch}},
+		{"GET", "/src/a/b.go", Match{Pattern: "/src/*filepath", Params: map[string]string{"filepath": "/a/b.go"}, Type: CatchAllMatch}},
+		{"GET", "/files/a/b/raw", Match{Pattern: "/files/:dir+/raw", Params: map[string]string{"dir": "a/b"}, Type: ParamMatch}},
+		{"GET", "/users/", Match{TSR: true}},
+		{"POST", "/users", Match{Allowed: []string{"GET", "PUT"}}},
+		{"POST", "/user/42", Match{Allowed: []string{"DELETE", "GET"}}},
+		{"GET", "/nope", Match{}},
+	}
+	for _, test := range tests {
+		got := router.Match(test.method, test.path)
+		if (got.Handle != nil) != (test.want.Type != NoMatch) {
+			t.Errorf("Match(%q, %q): want handle %t, got %t",
+				test.method, test.path, test.want.Type != NoMatch, got.Handle != nil)
+		}
+		got.Handle = nil
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Match(%q, %q) = %+v, want %+v", test.method, test.path, got, test.want)
+		}
+	}
+
+	router.HideMethodNotAllowed = true
+	if m := router.Match("POST", "/users"); m.Allowed != nil {
+		t.Errorf("allowed methods not hidden: %v", m.Allowed)
+	}
+}
+
+func TestRouterMatchHandleNext(t *testing.T) {
+	router := New()
+	router.HandleNext("GET", "/users/:id", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string, next func()) {
+		next()
+	})
+	notFound := false
+	router.NotFound = func(_ http.ResponseWriter, _ *http.Request) {
+		notFound = true
+	}
+
+	m := router.Match("GET", "/users/1")
+	if m.Handle == nil {
+		t.Fatal("no handle for route registered with HandleNext")
+	}
+	r, _ := http.NewRequest("GET", "/users/1", nil)
+	m.Handle(httptest.NewRecorder(), r, m.Params)
+	if !notFound {
+		t.Error("declined request not answered with the NotFound handler")
+	}
+}
+
+func TestRouterMatchWildcardOrder(t *testing.T) {
+	router := New()
+	router.GET("/:a/x/:b/*c", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {})
+
+	m := router.Match("GET", "/1/x/2/3")
+	wildcards, err := ParseWildcards(m.Pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names, values []string
+	for _, wildcard := range wildcards {
+		names = append(names, wildcard.Name)
+		values = append(values, m.Params[wildcard.Name])
+	}
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("wrong wildcard order: want %v, got %v", want, names)
+	}
+	if want := []string{"1", "2", "/3"}; !reflect.DeepEqual(values, want) {
+		t.Errorf("wrong values: want %v, got %v", want, values)
+	}
+}
+
+func TestRouterHandlerFor(t *testing.T) {
+	var got string
+	handleFor := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+			got = name
+		}
+	}
+
+	router := New()
+	router.GET("/", handleFor("root"))
+	router.GET("/users", handleFor("users"))
+	router.GET("/user/:id", handleFor("user"))
+	router.POST("/user/:id/posts", handleFor("posts"))
+	router.GET("/report-:id.json", handleFor("report"))
+	router.GET("/src/*filepath", handleFor("src"))
+	router.GET("/src/static", handleFor("static"))
+
+	tests := []struct {
+		method, pattern string
+		name            string
+	}{
+		{"GET", "/", "root"},
+		{"GET", "/users", "users"},
+		{"GET", "/user/:id", "user"},
+		{"POST", "/user/:id/posts", "posts"},
+		{"GET", "/report-:id.json", "report"},
+		{"GET", "/src/*filepath", "src"},
+		{"GET", "/src/static", "static"},
+		{"POST", "/users", ""},
+		{"GET", "/user/42", ""},
+		{"GET", "/user/:name", ""},
+		{"GET", "/user/:i", ""},
+		{"GET", "/user/:idx", ""},
+		{"GET", "/user/:id/posts", ""},
+		{"GET", "/src/*path", ""},
+		{"GET", "/src/a.go", ""},
+		{"GET", "/use", ""},
+		{"GET", "/nope", ""},
+	}
+
+	for _, test := range tests {
+		got = ""
+		handle, ok := router.HandlerFor(test.method, test.pattern)
+		if ok != (test.name != "") || (handle == nil) == ok {
+			t.Errorf("HandlerFor(%q, %q): want found=%t, got %t", test.method, test.pattern, test.name != "", ok)
+			continue
+		}
+		if ok {
+			handle(nil, nil, map[string]string{"id": "42"})
+			if got != test.name {
+				t.Errorf("HandlerFor(%q, %q): want handle %q, got %q", test.method, test.pattern, test.name, got)
+			}
+		}
+	}
+}
+
+func TestRouterRoutes(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.GET("/users", handle).Tag("public")
+	router.POST("/users", handle).Tag("admin", "internal")
+	router.DELETE("/users/:id", handle).Tag("admin").Tag("admin")
+	router.GET("/list/:page", handle).Default("page", "1").Tag("public")
+	router.GET("/x", handle).When(func(*http.Request) bool { return true }).Tag("canary")
+	router.GET("/x", handle)
+	router.GET("/metrics", handle).Tag("internal")
+
+	keys := func(routes []Route) []string {
+		var keys []string
+		for _, route := range routes {
+			keys = append(keys, route.Method+" "+route.Path)
+		}
+		return keys
+	}
+
+	want := []string{"GET /list/:page", "GET /metrics", "GET /users", "POST /users", "DELETE /users/:id", "GET /x", "GET /x"}
+	if got := keys(router.Routes()); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong routes:\nwant %q\ngot  %q", want, got)
+	}
+
+	tests := []struct {
+		tag    string
+		routes []string
+	}{
+		{"public", []string{"GET /list/:page", "GET /users"}},
+		{"admin", []string{"POST /users", "DELETE /users/:id"}},
+		{"internal", []string{"GET /metrics", "POST /users"}},
+		{"canary", []string{"GET /x"}},
+		{"none", nil},
+	}
+	for _, test := range tests {
+		if got := keys(router.RoutesByTag(test.tag)); !reflect.DeepEqual(got, test.routes) {
+			t.Errorf("RoutesByTag(%q): want %q, got %q", test.tag, test.routes, got)
+		}
+	}
+
+	route := router.RoutesByTag("admin")[1]
+	if tags := route.Tags(); !reflect.DeepEqual(tags, []string{"admin"}) {
+		t.Errorf("wrong tags: %q", tags)
+	}
+}
+
+func TestRouterRootHandler(t *testing.T) {
+	var got string
+	handleFor := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+			got = name
+		}
+	}
+
+	router := New()
+	router.RootHandler = handleFor("root")
+	router.GET("/users", handleFor("users"))
+
+	tests := []struct {
+		path string
+		name string
+	}{
+		{"/", "root"},
+		{"/users", "users"},
+		{"/nope", ""},
+	}
+	for _, test := range tests {
+		got = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", test.path, nil)
+		router.ServeHTTP(w, r)
+		if got != test.name {
+			t.Errorf("%s: want handle %q, got %q", test.path, test.name, got)
+		}
+		if test.name == "" && w.Code != http.StatusNotFound {
+			t.Errorf("%s: want code 404, got %d", test.path, w.Code)
+		}
+	}
+
+	// An explicit route for the root takes precedence.
+	router.GET("/", handleFor("explicit"))
+	got = ""
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	router.ServeHTTP(w, r)
+	if got != "explicit" {
+		t.Errorf("explicit root route not used: got %q", got)
+	}
+}
+
+// benchRouter returns a router with the routes of a representative REST API.
+func benchRouter() *Router {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	for _, resource := range []string{"users", "orders", "products", "invoices", "reviews"} {
+		router.GET("/api/v1/"+resource, handle)
+		router.POST("/api/v1/"+resource, handle)
+		router.GET("/api/v1/"+resource+"/:id", handle)
+		router.PUT("/api/v1/"+resource+"/:id", handle)
+		router.DELETE("/api/v1/"+resource+"/:id", handle)
+		router.GET("/api/v1/"+resource+"/:id/history", handle)
+	}
+	router.GET("/", handle)
+	router.GET("/health", handle)
+	router.GET("/static/*filepath", handle)
+	return router
+}
+
+func benchRequest(b *testing.B, router http.Handler, r *http.Request) {
+	w := new(mockResponseWriter)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(w, r)
+	}
+}
+
+func TestRouterStaticAllocs(t *testing.T) {
+	router := benchRouter()
+	w := new(mockResponseWriter)
+	r, _ := http.NewRequest("GET", "/api/v1/products", nil)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		router.ServeHTTP(w, r)
+	})
+	if allocs != 0 {
+		t.Errorf("serving a static route allocates: %v allocs per request", allocs)
+	}
+}
+
+func BenchmarkRouterStatic(b *testing.B) {
+	r, _ := http.NewRequest("GET", "/api/v1/products", nil)
+	benchRequest(b, benchRouter(), r)
+}
+
+func BenchmarkRouterParam(b *testing.B) {
+	r, _ := http.NewRequest("GET", "/api/v1/products/42/history", nil)
+	benchRequest(b, benchRouter(), r)
+}
+
+func BenchmarkRouter404(b *testing.B) {
+	r, _ := http.NewRequest("GET", "/api/v2/products", nil)
+	benchRequest(b, benchRouter(), r)
+}
+
+func TestRouterDeferTrailingSlashRedirect(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	// The NotFound handler renders a page for /foo/ and redirects all
+	// other requests.
+	var target string
+	var deferred bool
+	notFound := func(w http.ResponseWriter, r *http.Request) {
+		target, deferred = TrailingSlashRedirectFromContext(r.Context())
+		if deferred && r.URL.Path != "/foo/" {
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}
+
+	tests := []struct {
+		name     string
+		redirect bool
+		deferTSR bool
+		notFound http.HandlerFunc
+		path     string
+		code     int
+		target   string
+	}{
+		{"redirect", true, false, notFound, "/foo/", 301, ""},
+		{"off", false, false, notFound, "/foo/", 404, ""},
+		{"defer and render", true, true, notFound, "/foo/", 404, "/foo"},
+		{"defer and redirect", true, true, notFound, "/bar", 301, "/bar/"},
+		{"defer without NotFound", true, true, nil, "/foo/", 301, ""},
+		{"defer with default NotFound", true, true, NotFound, "/foo/", 301, ""},
+		{"defer without TSR", true, true, notFound, "/nope", 404, ""},
+	}
+
+	for _, test := range tests {
+		router := New()
+		router.GET("/foo", handle)
+		router.GET("/bar/", handle)
+		router.RedirectTrailingSlash = test.redirect
+		router.DeferTrailingSlashRedirect = test.deferTSR
+		router.NotFound = test.notFound
+
+		target, deferred = "", false
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || target != test.target || deferred != (test.target != "") {
+			t.Errorf("%s: want code %d and target %q, got %d and %q (deferred=%t)",
+				test.name, test.code, test.target, w.Code, target, deferred)
+		}
+	}
+}
+
+func TestRouterSubtree(t *testing.T) {
+	var got string
+	handle := func(_ http.ResponseWriter, req *http.Request, vars map[string]string) {
+		got = req.Method + " " + vars["rest"]
+	}
+
+	router := New()
+	router.Subtree("/admin", handle)
+	router.Subtree("/docs/", handle)
+	router.GET("/administrator", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		got = "administrator"
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{"GET", "/admin", "GET "},
+		{"GET", "/admin/", "GET /"},
+		{"GET", "/admin/users/5", "GET /users/5"},
+		{"DELETE", "/admin/users/5", "DELETE /users/5"},
+		{"GET", "/docs", "GET "},
+		{"GET", "/docs/intro", "GET /intro"},
+		{"GET", "/administrator", "administrator"},
+	}
+	for _, test := range tests {
+		got = ""
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(w, req)
+		if got != test.want {
+			t.Errorf("%s %s: want %q, got %q (%d)", test.method, test.path, test.want, got, w.Code)
+		}
+	}
+
+	root := New()
+	root.Subtree("/", handle)
+	req, _ := http.NewRequest("GET", "/a/b", nil)
+	root.ServeHTTP(httptest.NewRecorder(), req)
+	if got != "GET /a/b" {
+		t.Errorf("subtree of the root: want %q, got %q", "GET /a/b", got)
+	}
+}
+
+func TestRouterProxy(t *testing.T) {
+	var got string
+	handle := func(_ http.ResponseWriter, req *http.Request, vars map[string]string) {
+		got = req.Method + " " + vars["rest"]
+	}
+
+	for _, requiresSegment := range []bool{false, true} {
+		router := New()
+		router.CatchAllRequiresSegment = requiresSegment
+		router.Proxy("/proxy/", handle)
+		router.Proxy("/api", handle)
+
+		tests := []struct {
+			method string
+			path   string
+			want   string
+		}{
+			{"GET", "/proxy/", "GET "},
+			{"GET", "/proxy/a", "GET a"},
+			{"POST", "/proxy/a/b", "POST a/b"},
+			{"GET", "/proxy/a/b/", "GET a/b/"},
+			{"GET", "/api/", "GET "},
+			{"GET", "/api/v1", "GET v1"},
+		}
+		for _, test := range tests {
+			got = ""
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(test.method, test.path, nil)
+			router.ServeHTTP(w, req)
+			if got != test.want {
+				t.Errorf("CatchAllRequiresSegment=%t: %s %s: want %q, got %q (%d)",
+					requiresSegment, test.method, test.path, test.want, got, w.Code)
+			}
+		}
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/proxy", nil)
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/proxy/" {
+			t.Errorf("CatchAllRequiresSegment=%t: /proxy not redirected to /proxy/: %d %q",
+				requiresSegment, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRouterStripPrefix(t *testing.T) {
+	var got string
+	handle := func(_ http.ResponseWriter, req *http.Request, vars map[string]string) {
+		got = req.URL.Path + " " + vars["id"]
+	}
+
+	router := New()
+	router.GET("/", handle)
+	router.GET("/users/:id", handle)
+	router.GET("/dir/", handle)
+	router.Redirect("GET", "/old/:id", "/users/:id", http.StatusFound)
+
+	mux := http.NewServeMux()
+	mux.Handle("/app/", router.StripPrefix("/app/"))
+
+	tests := []struct {
+		path     string
+		code     int
+		got      string
+		location string
+	}{
+		{"/app/", http.StatusOK, "/ ", ""},
+		{"/app/users/5", http.StatusOK, "/users/5 5", ""},
+		{"/app/users/5/", http.StatusMovedPermanently, "", "/app/users/5"},
+		{"/app/dir?x=1", http.StatusMovedPermanently, "", "/app/dir/?x=1"},
+		{"/app/old/7", http.StatusFound, "", "/app/users/7"},
+		{"/app/nope", http.StatusNotFound, "", ""},
+	}
+	for _, test := range tests {
+		got = ""
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", test.path, nil)
+		mux.ServeHTTP(w, req)
+		if w.Code != test.code || got != test.got || w.Header().Get("Location") != test.location {
+			t.Errorf("%s: want %d %q %q, got %d %q %q", test.path,
+				test.code, test.got, test.location, w.Code, got, w.Header().Get("Location"))
+		}
+	}
+
+	h := router.StripPrefix("/app")
+	for _, path := range []string{"/application", "/other"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: path without the prefix served with %d", path, w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/app", nil)
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || got != "/ " {
+		t.Errorf("/app: want the root route, got %d %q", w.Code, got)
+	}
+
+	// The clean path redirect of the default NotFound handler, which
+	// http.ServeMux would issue itself.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/app/users//5", nil)
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/app/users/5" {
+		t.Errorf("/app/users//5: want redirect to /app/users/5, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	router.EmitLinkHeader = true
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/app/users/5", nil)
+	h.ServeHTTP(w, req)
+	if link := w.Header().Get("Link"); link != `</app/users/5>; rel="allow"; method="GET"` {
+		t.Errorf("/app/users/5: wrong Link header %q", link)
+	}
+
+	router.DeferTrailingSlashRedirect = true
+	var target string
+	router.NotFound = func(_ http.ResponseWriter, req *http.Request) {
+		target, _ = TrailingSlashRedirectFromContext(req.Context())
+	}
+	req, _ = http.NewRequest("GET", "/app/dir", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if target != "/app/dir/" {
+		t.Errorf("/app/dir: wrong deferred redirect target %q", target)
+	}
+}
+
+func TestConvertStdPattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		catchAll string
+	}{
+		{"/", "/", ""},
+		{"/items", "/items", ""},
+		{"/items/{id}", "/items/:id", ""},
+		{"/items/{id}/tags/{tag}", "/items/:id/tags/:tag", ""},
+		{"/files/{path...}", "/files/*path", "path"},
+		{"/items/{$}", "/items/", ""},
+	}
+	for _, test := range tests {
+		path, catchAll := convertStdPattern(test.pattern)
+		if path != test.path || catchAll != test.catchAll {
+			t.Errorf("convertStdPattern(%q) = %q, %q, want %q, %q",
+				test.pattern, path, catchAll, test.path, test.catchAll)
+		}
+	}
+
+	for _, pattern := range []string{"example.com/items", "/items/{id"} {
+		if recv := catchPanic(func() { convertStdPattern(pattern) }); recv == nil {
+			t.Errorf("no panic for unsupported pattern %q", pattern)
+		}
+	}
+}
+
+func TestRouterHandleStd(t *testing.T) {
+	var got string
+	var vars map[string]string
+	handlerFor := func(name string) http.Handler {
+		return http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			got = name
+			vars = VarsFromContext(r.Context())
+		})
+	}
+
+	router := New()
+	router.HandleStd("GET /items/{id}", handlerFor("get item"))
+	router.HandleStd("DELETE  /items/{id}", handlerFor("delete item"))
+	router.HandleStd("/files/{path...}", handlerFor("files"))
+	// GET patterns match HEAD requests, unless there is a HEAD pattern,
+	// registered before or after them.
+	router.HandleStd("HEAD /before", handlerFor("head before"))
+	router.HandleStd("GET /before", handlerFor("get before"))
+	router.HandleStd("GET /after", handlerFor("get after"))
+	router.HandleStd("HEAD /after", handlerFor("head after"))
+
+	tests := []struct {
+		method string
+		path   string
+		name   string
+		vars   map[string]string
+	}{
+		{"GET", "/items/42", "get item", map[string]string{"id": "42"}},
+		{"DELETE", "/items/42", "delete item", map[string]string{"id": "42"}},
+		{"POST", "/items/42", "", nil},
+		{"GET", "/files/a/b.txt", "files", map[string]string{"path": "a/b.txt"}},
+		{"PUT", "/files/c", "files", map[string]string{"path": "c"}},
+		{"HEAD", "/items/42", "get item", map[string]string{"id": "42"}},
+		{"HEAD", "/before", "head before", nil},
+		{"GET", "/before", "get before", nil},
+		{"HEAD", "/after", "head after", nil},
+		{"GET", "/after", "get after", nil},
+	}
+
+	for _, test := range tests {
+		got, vars = "", nil
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(w, r)
+		if got != test.name || !reflect.DeepEqual(vars, test.vars) {
+			t.Errorf("%s %s: want %q with %v, got %q with %v",
+				test.method, test.path, test.name, test.vars, got, vars)
+		}
+	}
+}
+
+func TestRouterGlobalOPTIONS(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.GET("/users", handle)
+	router.POST("/users", handle)
+	router.DELETE("/users/:id", handle)
+
+	newRequest := func() *http.Request {
+		r := httptest.NewRequest("OPTIONS", "/", nil)
+		r.URL.Path = "*"
+		r.RequestURI = "*"
+		return r
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newRequest())
+	if w.Code != http.StatusOK {
+		t.Errorf("wrong status code for OPTIONS *: want 200, got %d", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "DELETE, GET, OPTIONS, POST" {
+		t.Errorf("wrong Allow header for OPTIONS *: %q", allow)
+	}
+
+	called := false
+	router.GlobalOPTIONS = func(w http.ResponseWriter, _ *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusNoContent)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, newRequest())
+	if !called || w.Code != http.StatusNoContent {
+		t.Errorf("GlobalOPTIONS not invoked: called=%t, code=%d", called, w.Code)
+	}
+}
+
+func TestRouterTreeJSON(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.StablePriorities = true
+	router.GET("/", handle)
+	router.GET("/users/:id", handle)
+	router.PUT("/users/:id", handle)
+	router.GET("/src/*filepath", handle)
+
+	got, err := router.TreeJSON()
+	if err != nil {
+		t.Fatalf("TreeJSON failed: %v", err)
+	}
+	want := `{"path":"/","indices":"su","nType":"static","methods":["GET"],"children":[` +
+		`{"path":"src/","nType":"static","children":[{"path":"*filepath","nType":"catchAll","methods":["GET"]}]},` +
+		`{"path":"users/","nType":"static","children":[{"path":":id","nType":"param","methods":["GET","PUT"]}]}]}`
+	if string(got) != want {
+		t.Errorf("wrong tree JSON:\nwant %s\ngot  %s", want, got)
+	}
+}
+
+func TestRouterRedirectHandler(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.GET("/path", handle)
+	router.GET("/dir/", handle)
+
+	var target string
+	router.RedirectHandler = func(w http.ResponseWriter, r *http.Request, newPath string) {
+		target = newPath
+		http.Redirect(w, r, newPath, http.StatusFound)
+	}
+
+	tests := []struct {
+		url    string
+		target string
+	}{
+		{"/path/?q=1", "/path?q=1"},
+		{"/dir", "/dir/"},
+		{"/../path?a=b&c=d", "/path?a=b&c=d"},
+	}
+
+	for _, test := range tests {
+		target = ""
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", test.url, nil)
+		router.ServeHTTP(w, r)
+		if target != test.target || w.Code != http.StatusFound {
+			t.Errorf("%s: want redirect to %q with code 302, got %q with code %d", test.url, test.target, target, w.Code)
+		}
+	}
+
+	// Without a RedirectHandler the query string is preserved as well.
+	router.RedirectHandler = nil
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/path/?q=1", nil)
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/path?q=1" {
+		t.Errorf("wrong default redirect: code=%d, Location=%q", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestRouterSPA(t *testing.T) {
+	router := New()
+	router.GET("/api/users", func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		w.Write([]byte("users"))
+	})
+	router.POST("/api/users", func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {})
+	router.SPA(http.FS(fstest.MapFS{
+		"index.html":       {Data: []byte("index")},
+		"assets/app.js":    {Data: []byte("app")},
+		"assets/img/.keep": {Data: []byte{}},
+	}))
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{"GET", "/api/users", 200, "users"},
+		{"GET", "/assets/app.js", 200, "app"},
+		{"GET", "/", 200, "index"},
+		{"GET", "/anything-else", 200, "index"},
+		{"GET", "/settings/profile", 200, "index"},
+		{"GET", "/assets/img/", 200, "index"},
+		{"DELETE", "/api/users", 405, ""},
+		{"POST", "/anything-else", 404, ""},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		router.ServeHTTP(w, r)
+		if w.Code != test.code || test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s %s: want %d %q, got %d %q", test.method, test.path, test.code, test.body, w.Code, w.Body.String())
+		}
+	}
+}
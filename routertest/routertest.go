@@ -0,0 +1,48 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+// Package routertest provides helpers for testing the routes of a
+// httprouter.Router.
+package routertest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/deiio/httprouter"
+)
+
+// AssertRoute checks that a request with the method and path is routed to
+// the route registered for wantPattern and that the wildcard values are
+// wantVars. A nil or empty wantVars expects no wildcard values, an empty
+// wantPattern expects no route to match. Otherwise an error is reported to t.
+// It returns whether the assertion holds.
+func AssertRoute(t testing.TB, r *httprouter.Router, method, path, wantPattern string, wantVars map[string]string) bool {
+	t.Helper()
+
+	pattern, ok := r.Pattern(method, path)
+	if wantPattern == "" {
+		if ok {
+			t.Errorf("%s %s: want no route, matched %q", method, path, pattern)
+			return false
+		}
+		return true
+	}
+	if !ok {
+		t.Errorf("%s %s: want route %q, no route matched", method, path, wantPattern)
+		return false
+	}
+	if pattern != wantPattern {
+		t.Errorf("%s %s: want route %q, matched %q", method, path, wantPattern, pattern)
+		return false
+	}
+
+	_, vars, _, _ := r.Lookup(method, path)
+	if len(vars) != 0 || len(wantVars) != 0 {
+		if !reflect.DeepEqual(vars, wantVars) {
+			t.Errorf("%s %s: want vars %v, got %v", method, path, wantVars, vars)
+			return false
+		}
+	}
+	return true
+}
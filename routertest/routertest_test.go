@@ -0,0 +1,62 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package routertest
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/deiio/httprouter"
+)
+
+// recorder is a testing.TB which records the reported errors.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertRoute(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := httprouter.New()
+	router.GET("/", handle)
+	router.GET("/user/:id", handle)
+	router.GET("/src/*filepath", handle)
+
+	tests := []struct {
+		method, path string
+		pattern      string
+		vars         map[string]string
+		pass         bool
+	}{
+		{"GET", "/", "/", nil, true},
+		{"GET", "/", "/", map[string]string{}, true},
+		{"GET", "/user/42", "/user/:id", map[string]string{"id": "42"}, true},
+		{"GET", "/src/a/b.go", "/src/*filepath", map[string]string{"filepath": "/a/b.go"}, true},
+		{"GET", "/nope", "", nil, true},
+		{"POST", "/user/42", "", nil, true},
+		{"GET", "/user/42", "/user/:name", map[string]string{"id": "42"}, false},
+		{"GET", "/user/42", "/user/:id", map[string]string{"id": "43"}, false},
+		{"GET", "/user/42", "/user/:id", nil, false},
+		{"GET", "/", "/", map[string]string{"id": "42"}, false},
+		{"GET", "/nope", "/nope", nil, false},
+		{"GET", "/user/42", "", nil, false},
+	}
+
+	for _, test := range tests {
+		rec := &recorder{TB: t}
+		pass := AssertRoute(rec, router, test.method, test.path, test.pattern, test.vars)
+		if pass != test.pass || (len(rec.errors) == 0) != test.pass {
+			t.Errorf("AssertRoute(%s %s, %q, %v): want pass=%t, got %t with errors %q",
+				test.method, test.path, test.pattern, test.vars, test.pass, pass, rec.errors)
+		}
+	}
+}
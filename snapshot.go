@@ -0,0 +1,125 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// Snapshot returns a deep copy of the router with its routes and options,
+// which is not affected by later modifications of the router. The snapshot
+// itself is read-only: registering routes with it panics. Together with
+// Install, it allows to serve requests from a snapshot while the routes of
+// the router are modified, without locking the lookups, e.g.:
+//
+//	router.Install(router.Snapshot())
+//	// Requests are served from the snapshot while the router is modified.
+//	router.GET("/new", New)
+//	router.Install(router.Snapshot())
+//
+// Snapshot must not be called concurrently with modifications of the router.
+// Routes registered with LazyCompile are compiled first.
+func (r *Router) Snapshot() *Router {
+	r.Compile()
+
+	s := new(Router)
+	*s = *r
+	s.live = atomic.Value{}
+	s.lazy = nil
+	s.inFlight = 0
+	s.frozen = true
+
+	if r.NotFoundByMethod != nil {
+		s.NotFoundByMethod = make(map[string]http.HandlerFunc, len(r.NotFoundByMethod))
+		for method, h := range r.NotFoundByMethod {
+			s.NotFoundByMethod[method] = h
+		}
+	}
+	s.methods = append([]string(nil), r.methods...)
+	s.middleware = append([]Middleware(nil), r.middleware...)
+
+	s.node = r.node.clone(s, make(map[*Route]*Route))
+	return s
+}
+
+// clone returns a deep copy of the node and its children. The routes are
+// copied once each and registered with the router, routes maps the routes of
+// n to their copies.
+func (n *node) clone(router *Router, routes map[*Route]*Route) node {
+	c := *n
+	c.indices = append([]byte(nil), n.indices...)
+	if n.children != nil {
+		c.children = make([]*node, len(n.children))
+		for i, child := range n.children {
+			cc := child.clone(router, routes)
+			c.children[i] = &cc
+		}
+	}
+	if n.catchAllChild != nil {
+		cc := n.catchAllChild.clone(router, routes)
+		c.catchAllChild = &cc
+	}
+
+	c.handle.route = n.handle.route.clone(router, routes)
+	if n.handle.routes != nil {
+		c.handle.routes = make(map[string]*Route, len(n.handle.routes))
+		for method, route := range n.handle.routes {
+			c.handle.routes[method] = route.clone(router, routes)
+		}
+	}
+	return c
+}
+
+// clone returns a copy of the route and the candidates after it, registered
+// with the router. Routes already copied are looked up in routes.
+func (rt *Route) clone(router *Router, routes map[*Route]*Route) *Route {
+	if rt == nil {
+		return nil
+	}
+	if c, ok := routes[rt]; ok {
+		return c
+	}
+
+	c := new(Route)
+	*c = *rt
+	routes[rt] = c
+	c.router = router
+	if rt.defaults != nil {
+		c.defaults = make(map[string]string, len(rt.defaults))
+		for name, value := range rt.defaults {
+			c.defaults[name] = value
+		}
+	}
+	if rt.aliases != nil {
+		c.aliases = make(map[string]string, len(rt.aliases))
+		for alias, name := range rt.aliases {
+			c.aliases[alias] = name
+		}
+	}
+	c.consumes = append([]string(nil), rt.consumes...)
+	c.middleware = append([]scopedMiddleware(nil), rt.middleware...)
+	c.validators = append([]func(*http.Request) error(nil), rt.validators...)
+	c.tags = append([]string(nil), rt.tags...)
+	c.alt = rt.alt.clone(router, routes)
+	return c
+}
+
+// Install atomically installs the snapshot as the routes served by the
+// router: ServeHTTP and TryServeHTTP dispatch all further requests with the
+// snapshot, including its options, until another snapshot is installed.
+// Installing nil reverts to serving the routes of the router itself.
+// Install is safe to call while requests are served.
+func (r *Router) Install(snapshot *Router) {
+	if snapshot == r {
+		snapshot = nil
+	}
+	r.live.Store(snapshot)
+}
+
+// installed returns the snapshot installed with Install, or nil.
+func (r *Router) installed() *Router {
+	s, _ := r.live.Load().(*Router)
+	return s
+}
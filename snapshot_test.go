@@ -0,0 +1,149 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestRouterSnapshot(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.GET("/users/:id", handle)
+	files := router.GET("/files/*filepath", handle).Tag("files")
+
+	snapshot := router.Snapshot()
+
+	// Modifications of the router don't affect the snapshot.
+	router.GET("/users/:id/posts", handle)
+	router.POST("/users/:id", handle)
+	files.Tag("static")
+
+	for _, test := range []struct {
+		method, path string
+		router, snap bool
+	}{
+		{"GET", "/users/1", true, true},
+		{"GET", "/files/a/b", true, true},
+		{"GET", "/users/1/posts", true, false},
+		{"POST", "/users/1", true, false},
+	} {
+		if route, _, _ := router.getValue(test.method, test.path); (route != nil) != test.router {
+			t.Errorf("router: %s %s matched: want %t", test.method, test.path, test.router)
+		}
+		if route, _, _ := snapshot.getValue(test.method, test.path); (route != nil) != test.snap {
+			t.Errorf("snapshot: %s %s matched: want %t", test.method, test.path, test.snap)
+		} else if route != nil && route.router != snapshot {
+			t.Errorf("snapshot: route of %s %s isn't registered with the snapshot", test.method, test.path)
+		}
+	}
+
+	if n := len(snapshot.RoutesByTag("static")); n != 0 {
+		t.Errorf("snapshot: tag added to the router's route is visible, got %d routes", n)
+	}
+	if allowed := snapshot.allowed("/users/1"); len(allowed) != 1 || allowed[0] != "GET" {
+		t.Errorf("snapshot: wrong allowed methods: want [GET], got %v", allowed)
+	}
+
+	// Snapshots are read-only.
+	recv := catchPanic(func() {
+		snapshot.GET("/new", handle)
+	})
+	if recv == nil {
+		t.Error("no panic while registering a route with a snapshot")
+	}
+}
+
+func TestRouterInstall(t *testing.T) {
+	handleFor := func(body string) Handle {
+		return func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+			fmt.Fprint(w, body)
+		}
+	}
+
+	router := New()
+	router.GET("/", handleFor("v1"))
+
+	serve := func(path string) (int, string) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	router.Install(router.Snapshot())
+	router.GET("/new", handleFor("new"))
+	if code, body := serve("/"); code != http.StatusOK || body != "v1" {
+		t.Errorf("installed snapshot: want 200 v1, got %d %s", code, body)
+	}
+	if code, _ := serve("/new"); code != http.StatusNotFound {
+		t.Errorf("installed snapshot: route registered afterwards served, got %d", code)
+	}
+
+	router.Install(router.Snapshot())
+	if code, body := serve("/new"); code != http.StatusOK || body != "new" {
+		t.Errorf("new snapshot: want 200 new, got %d %s", code, body)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/new", nil)
+	if !router.TryServeHTTP(w, req) || w.Body.String() != "new" {
+		t.Errorf("TryServeHTTP: snapshot not served, got %q", w.Body.String())
+	}
+
+	// Installing nil serves the router's own routes again.
+	router.Install(nil)
+	router.GET("/newer", handleFor("newer"))
+	if code, body := serve("/newer"); code != http.StatusOK || body != "newer" {
+		t.Errorf("uninstalled snapshot: want 200 newer, got %d %s", code, body)
+	}
+}
+
+func TestRouterInstallConcurrent(t *testing.T) {
+	handle := func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	router := New()
+	router.GET("/static/*filepath", handle)
+	router.Install(router.Snapshot())
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				w := httptest.NewRecorder()
+				req, _ := http.NewRequest("GET", "/static/app.js", nil)
+				router.ServeHTTP(w, req)
+				if w.Code != http.StatusNoContent {
+					t.Errorf("wrong status: want %d, got %d", http.StatusNoContent, w.Code)
+					return
+				}
+			}
+		}()
+	}
+
+	// Modify the router while requests are served from the snapshots.
+	for i := 0; i < 200; i++ {
+		router.GET(fmt.Sprintf("/api/v%d/users/:id", i), handle).Tag("api")
+		if i%20 == 0 {
+			router.Install(router.Snapshot())
+		}
+	}
+	close(done)
+	wg.Wait()
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+// checkAmbiguity panics if the path may match the same request paths as a
+// path registered for the method before, except the path itself, see
+// StrictRoutes.
+func (r *Router) checkAmbiguity(method, path string) {
+	check := func(other string) {
+		if other != path && ambiguous(path, other, r.ParamSeparators) {
+			panic("ambiguous route: '" + method + " " + path +
+				"' may match the same paths as existing route '" + method + " " + other + "'")
+		}
+	}
+
+	r.node.walk("", func(p string, n *node) {
+		if n.handle.get(method) != nil {
+			check(p)
+		}
+	})
+	if r.lazy != nil {
+		r.lazy.mu.RLock()
+		defer r.lazy.mu.RUnlock()
+		for _, routes := range r.lazy.pending {
+			for _, pr := range routes {
+				if pr.method == method {
+					check(pr.path)
+				}
+			}
+		}
+	}
+}
+
+// patternToken is a literal byte, a param or a catch-all of a path pattern.
+type patternToken struct {
+	lit      byte
+	wildcard byte // ':' for params, '+' for greedy params, '*' for catch-alls
+}
+
+// tokenize splits the pattern into tokens.
+func tokenize(pattern string) []patternToken {
+	var tokens []patternToken
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case ':', '*':
+			k := i + 1
+			for k < len(pattern) && isNameChar(pattern[k]) {
+				k++
+			}
+			if c == ':' && k < len(pattern) && pattern[k] == '+' {
+				c = '+'
+				k++
+			}
+			tokens = append(tokens, patternToken{wildcard: c})
+			i = k - 1
+		default:
+			tokens = append(tokens, patternToken{lit: c})
+		}
+	}
+	return tokens
+}
+
+// accepts reports whether the value of the param token may contain c.
+func (t patternToken) accepts(c byte, seps string) bool {
+	return t.wildcard == '+' || !isParamEnd(c, seps)
+}
+
+// ambiguous reports whether a request path exists which both patterns match.
+// It searches for such a path byte by byte, following both patterns at the
+// same time. A param matches one or more bytes, except '/' and the
+// separators, a greedy param one or more arbitrary bytes, and a catch-all
+// matches any rest of the path.
+func ambiguous(a, b, seps string) bool {
+	ta, tb := tokenize(a), tokenize(b)
+
+	// A state is a position in each pattern, and whether the param at the
+	// position has matched a byte already and thus may end.
+	type state struct {
+		i, j   int
+		pa, pb bool
+	}
+	seen := make(map[state]bool)
+
+	var search func(s state) bool
+	search = func(s state) bool {
+		if seen[s] {
+			return false
+		}
+		seen[s] = true
+
+		if s.i < len(ta) && ta[s.i].wildcard == '*' || s.j < len(tb) && tb[s.j].wildcard == '*' {
+			return true
+		}
+		if s.i == len(ta) && s.j == len(tb) {
+			return true
+		}
+		// End a param which has matched a byte already.
+		if s.pa && search(state{s.i + 1, s.j, false, s.pb}) {
+			return true
+		}
+		if s.pb && search(state{s.i, s.j + 1, s.pa, false}) {
+			return true
+		}
+		if s.i == len(ta) || s.j == len(tb) {
+			return false
+		}
+
+		// Match the next byte of the path with both patterns.
+		x, y := ta[s.i], tb[s.j]
+		next := state{s.i + 1, s.j + 1, false, false}
+		if x.wildcard != 0 {
+			next.i, next.pa = s.i, true
+		}
+		if y.wildcard != 0 {
+			next.j, next.pb = s.j, true
+		}
+		switch {
+		case x.wildcard == 0 && y.wildcard == 0:
+			return x.lit == y.lit && search(next)
+		case x.wildcard == 0:
+			return y.accepts(x.lit, seps) && search(next)
+		case y.wildcard == 0:
+			return x.accepts(y.lit, seps) && search(next)
+		default:
+			// Both params match a byte which none of them ends at, e.g. 'x'.
+			return search(next)
+		}
+	}
+	return search(state{})
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAmbiguous(t *testing.T) {
+	tests := []struct {
+		a, b      string
+		seps      string
+		ambiguous bool
+	}{
+		{"/users/:id", "/users/*rest", "", true},
+		{"/users/new", "/users/*rest", "", true},
+		{"/a/*b", "/a/x/*c", "", true},
+		{"/a/*b", "/b/*c", "", false},
+		{"/users/:id", "/users/new", "", true},
+		{"/users/:id", "/users/new/edit", "", false},
+		{"/users/:id", "/users", "", false},
+		{"/users/:id/a", "/users/:name/b", "", false},
+		{"/f/:name.json", "/f/:name", "", true},
+		{"/f/:name.json", "/f/x.xml", "", false},
+		{"/m/:group.:name", "/m/:group", ".", false},
+		{"/m/:group.:name", "/m/:group", "", true},
+		{"/r/:repo+/c", "/r/x/y/c", "", true},
+		{"/r/:repo+/c", "/r/x/y", "", false},
+		{"/u_:a", "/u_x", "", true},
+		{"/:a/:b", "/:c", "", false},
+		{"/:a/x", "/y/:b", "", true},
+	}
+	for _, test := range tests {
+		if got := ambiguous(test.a, test.b, test.seps); got != test.ambiguous {
+			t.Errorf("ambiguous(%q, %q, %q) = %t, want %t", test.a, test.b, test.seps, got, test.ambiguous)
+		}
+		if got := ambiguous(test.b, test.a, test.seps); got != test.ambiguous {
+			t.Errorf("ambiguous(%q, %q, %q) = %t, want %t", test.b, test.a, test.seps, got, test.ambiguous)
+		}
+	}
+}
+
+func TestRouterStrictRoutes(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {}
+
+	router := New()
+	router.StrictRoutes = true
+	router.GET("/users/:id", handle).When(func(*http.Request) bool { return false })
+	router.GET("/users/:id/posts", handle)
+	router.GET("/files/*filepath", handle)
+	router.POST("/users/*rest", handle)
+	router.GET("/list/:page", handle).Default("page", "1").BothSlashes()
+	router.GET("/users/:id", handle)
+
+	for _, path := range []string{"/users/*rest", "/files/a/b"} {
+		recv := catchPanic(func() {
+			router.GET(path, handle)
+		})
+		if msg, _ := recv.(string); !strings.Contains(msg, "ambiguous route") {
+			t.Errorf("GET %s: want a panic for an ambiguous route, got %v", path, recv)
+		}
+	}
+
+	err := router.BuildFrom([]RouteSpec{{"POST", "/users/new", handle}})
+	if err == nil || !strings.Contains(err.Error(), "'POST /users/*rest'") {
+		t.Errorf("BuildFrom: want an error naming the ambiguous route, got %v", err)
+	}
+
+	lazy := New()
+	lazy.StrictRoutes = true
+	lazy.LazyCompile = true
+	lazy.GET("/a/*b", handle)
+	if recv := catchPanic(func() { lazy.GET("/a/x", handle) }); recv == nil {
+		t.Error("ambiguity with a pending route not detected")
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Timeout sets the time the handle of the route may take to answer a request,
+// which overrides the HandlerTimeout of the router. A timeout of 0 or less
+// disables the HandlerTimeout for the route.
+func (rt *Route) Timeout(d time.Duration) *Route {
+	if d <= 0 {
+		d = -1
+	}
+	rt.timeout = d
+	return rt
+}
+
+// handlerTimeout returns the timeout of the route, or 0 if it has none.
+func (r *Router) handlerTimeout(route *Route) time.Duration {
+	d := r.HandlerTimeout
+	if route.timeout != 0 {
+		d = route.timeout
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// timeoutWriter buffers the response of a handle running with a timeout, so
+// that it can be discarded if the timeout is exceeded.
+type timeoutWriter struct {
+	mu          sync.Mutex
+	h           http.Header
+	buf         bytes.Buffer
+	code        int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.code, tw.wroteHeader = http.StatusOK, true
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.code, tw.wroteHeader = code, true
+}
+
+// serveTimeout invokes the handle with a request whose context has the
+// timeout. The handle runs in its own goroutine and writes to a buffer, which
+// is copied to w once it returns. If the timeout is exceeded first, the
+// request is answered with "503 Service Unavailable" instead, and later
+// writes of the handle fail with http.ErrHandlerTimeout.
+// It reports whether the handle returned in time. Panics of the handle are
+// propagated to the caller.
+func (r *Router) serveTimeout(w http.ResponseWriter, req *http.Request, d time.Duration, handle func(http.ResponseWriter, *http.Request)) bool {
+	ctx, cancel := context.WithTimeout(req.Context(), d)
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	tw := &timeoutWriter{h: w.Header().Clone()}
+	done := make(chan struct{})
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				panicked <- p
+			}
+		}()
+		handle(tw, req)
+		close(done)
+	}()
+
+	select {
+	case p := <-panicked:
+		panic(p)
+
+	case <-done:
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		dst := w.Header()
+		for key := range dst {
+			if _, ok := tw.h[key]; !ok {
+				delete(dst, key)
+			}
+		}
+		for key, values := range tw.h {
+			dst[key] = values
+		}
+		if tw.wroteHeader {
+			w.WriteHeader(tw.code)
+			w.Write(tw.buf.Bytes())
+		}
+		return true
+
+	case <-ctx.Done():
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		tw.timedOut = true
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			r.writeError(w, req, http.StatusServiceUnavailable)
+		}
+		return false
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2024 Furzoom.com, All rights reserved.
+// Author: Furzoom, mn@furzoom.com
+
+package httprouter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouterHandlerTimeout(t *testing.T) {
+	// slow blocks until the request is answered and reports the error of
+	// writing afterwards.
+	release := make(chan struct{})
+	writeErr := make(chan error, 1)
+	slow := func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		<-release
+		_, err := w.Write([]byte("late"))
+		writeErr <- err
+	}
+	fast := func(w http.ResponseWriter, req *http.Request, _ map[string]string) {
+		if _, ok := req.Context().Deadline(); !ok {
+			t.Error("no deadline in the request context")
+		}
+		w.Header().Set("X-Fast", "1")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, "fast")
+	}
+	sleep := func(w http.ResponseWriter, _ *http.Request, _ map[string]string) {
+		time.Sleep(30 * time.Millisecond)
+		fmt.Fprint(w, "done")
+	}
+
+	router := New()
+	router.HandlerTimeout = 10 * time.Millisecond
+	router.GET("/slow", slow)
+	router.GET("/fast", fast)
+	router.GET("/sleep", sleep)
+	router.GET("/sleep/longer", sleep).Timeout(time.Second)
+	router.GET("/sleep/unlimited", sleep).Timeout(0)
+	router.GET("/empty", func(http.ResponseWriter, *http.Request, map[string]string) {}).NoContent()
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/slow", http.StatusServiceUnavailable, "Service Unavailable\n"},
+		{"/fast", http.StatusCreated, "fast"},
+		{"/sleep", http.StatusServiceUnavailable, "Service Unavailable\n"},
+		{"/sleep/longer", http.StatusOK, "done"},
+		{"/sleep/unlimited", http.StatusOK, "done"},
+		{"/empty", http.StatusNoContent, ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", test.path, nil)
+		router.ServeHTTP(w, req)
+		if w.Code != test.code || w.Body.String() != test.body {
+			t.Errorf("%s: want %d %q, got %d %q", test.path, test.code, test.body, w.Code, w.Body.String())
+		}
+		if test.path == "/fast" && w.Header().Get("X-Fast") != "1" {
+			t.Errorf("%s: header of the handle not written", test.path)
+		}
+		if test.path == "/slow" {
+			close(release)
+		}
+	}
+
+	select {
+	case err := <-writeErr:
+		if !errors.Is(err, http.ErrHandlerTimeout) {
+			t.Errorf("write after the timeout: want %v, got %v", http.ErrHandlerTimeout, err)
+		}
+	case <-time.After(time.Second):
+		t.Error("slow handle didn't return")
+	}
+}
+
+func TestRouterHandlerTimeoutPanic(t *testing.T) {
+	router := New()
+	router.HandlerTimeout = time.Second
+	router.PanicHandler = func(w http.ResponseWriter, _ *http.Request, p interface{}) {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, p)
+	}
+	router.GET("/panic", func(http.ResponseWriter, *http.Request, map[string]string) {
+		panic("oops")
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/panic", nil)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError || w.Body.String() != "oops" {
+		t.Errorf("panic not recovered: got %d %q", w.Code, w.Body.String())
+	}
+}
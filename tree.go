@@ -3,6 +3,15 @@
 
 package httprouter
 
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unsafe"
+)
+
 func min(a, b int) int {
 	if a <= b {
 		return a
@@ -24,8 +33,113 @@ type node struct {
 	children  []*node
 	wildChild bool
 	nType     nodeType
-	handle    map[string]Handle
+	handle    handles
 	priority  uint32
+
+	// For param nodes: the characters besides '/' which terminate the value.
+	seps string
+
+	// For nodes whose path ends with '/': the catch-all wildcard following
+	// the '/', which matches if no other child does.
+	catchAllChild *node
+}
+
+// handles holds the routes registered at a node by method. Since most nodes
+// hold the route of a single method, it is stored inline and the routes are
+// only moved to a map once a second method is registered.
+type handles struct {
+	method string
+	route  *Route
+	routes map[string]*Route
+}
+
+// get returns the route registered for the method, or nil.
+func (h *handles) get(method string) *Route {
+	if h.routes != nil {
+		return h.routes[method]
+	}
+	if h.method == method {
+		return h.route
+	}
+	return nil
+}
+
+// set registers the route for the method.
+func (h *handles) set(method string, route *Route) {
+	switch {
+	case h.routes != nil:
+		h.routes[method] = route
+	case h.route == nil || h.method == method:
+		h.method, h.route = method, route
+	default:
+		h.routes = map[string]*Route{
+			h.method: h.route,
+			method:   route,
+		}
+		h.method, h.route = "", nil
+	}
+}
+
+// methods returns the sorted methods with a registered route.
+func (h *handles) methods() []string {
+	if h.routes == nil {
+		if h.route == nil {
+			return nil
+		}
+		return []string{h.method}
+	}
+
+	methods := make([]string, 0, len(h.routes))
+	for method := range h.routes {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// len returns the number of methods with a registered route.
+func (h *handles) len() int {
+	if h.routes != nil {
+		return len(h.routes)
+	}
+	if h.route != nil {
+		return 1
+	}
+	return 0
+}
+
+// isParamEnd reports whether c terminates the value of a parameter with the
+// given separators.
+func isParamEnd(c byte, seps string) bool {
+	return c == '/' || len(seps) > 0 && strings.IndexByte(seps, c) >= 0
+}
+
+// paramSeparators returns the separators configured for the router the route
+// is registered with.
+func paramSeparators(route *Route) string {
+	if route == nil || route.router == nil {
+		return ""
+	}
+	return route.router.ParamSeparators
+}
+
+// stablePriorities reports whether the router the route is registered with
+// keeps the children of nodes in a deterministic order, or orders them only
+// after a BuildFrom.
+func stablePriorities(route *Route) bool {
+	return route != nil && route.router != nil && (route.router.StablePriorities || route.router.bulk)
+}
+
+// insertIndex inserts the child for the index byte c, keeping the children
+// sorted by their index.
+func (n *node) insertIndex(c byte, child *node) {
+	i := sort.Search(len(n.indices), func(i int) bool { return n.indices[i] > c })
+	n.indices = append(n.indices, 0)
+	copy(n.indices[i+1:], n.indices[i:])
+	n.indices[i] = c
+	n.children = append(n.children, nil)
+	copy(n.children[i+1:], n.children[i:])
+	n.children[i] = child
 }
 
 func (n *node) incrementChildPrio(i int) int {
@@ -39,11 +153,114 @@ func (n *node) incrementChildPrio(i int) int {
 	return i
 }
 
+// reorderChild moves the child at position i to the position matching its
+// priority and returns the new position.
+func (n *node) reorderChild(i int) int {
+	prio := n.children[i].priority
+
+	// Adjust position (move to front).
+	for j := i - 1; j >= 0 && n.children[j].priority < prio; j-- {
+		n.children[i], n.children[j] = n.children[j], n.children[i]
+		n.indices[i], n.indices[j] = n.indices[j], n.indices[i]
+		i--
+	}
+
+	// Adjust position (move to back).
+	for j := i + 1; j < len(n.children) && n.children[j].priority > prio; j++ {
+		n.children[i], n.children[j] = n.children[j], n.children[i]
+		n.indices[i], n.indices[j] = n.indices[j], n.indices[i]
+		i++
+	}
+	return i
+}
+
+// findPath returns the node holding the registered path, its parent and its
+// position among the children of the parent. Wildcards in the path only match
+// the wildcards with the same name.
+func (n *node) findPath(path string) (found, parent *node, i int) {
+	for strings.HasPrefix(path, n.path) {
+		path = path[len(n.path):]
+		if len(path) == 0 {
+			return n, parent, i
+		}
+
+		if n.wildChild {
+			parent, i, n = n, 0, n.children[0]
+			continue
+		}
+
+		next := -1
+		for j, index := range n.indices {
+			if path[0] == index {
+				next = j
+				break
+			}
+		}
+		if next < 0 {
+			break
+		}
+		parent, i, n = n, next, n.children[next]
+	}
+	return nil, nil, 0
+}
+
+// setPriority sets the priority of the node holding the registered path and
+// reorders it among its siblings.
+func (n *node) setPriority(path string, prio uint32) {
+	found, parent, i := n.findPath(path)
+	if found == nil {
+		return
+	}
+
+	found.priority = prio
+	if parent != nil && len(parent.indices) > 0 {
+		parent.reorderChild(i)
+	}
+}
+
 // addRoute adds a node with the given handle to the path.
 // Attention! Not concurrency-safe!
-func (n *node) addRoute(method, path string, handle Handle) {
+func (n *node) addRoute(method, path string, route *Route) {
+	n.insertRoute(method, path, path, route)
+}
+
+// conflict panics because the path conflicts with an existing route.
+func conflict(reason, fullPath, existing string) {
+	panic(reason + ": '" + fullPath + "' conflicts with existing route '" + existing + "'")
+}
+
+// nameMismatch panics if the wildcard name differs from the name of the
+// wildcard existing at the same position, which would otherwise be used for
+// the values of both routes.
+func nameMismatch(name, existingName, fullPath, existing string) {
+	if name != existingName {
+		panic("wildcard '" + name + "' in new path '" + fullPath + "' must have the same name as wildcard '" +
+			existingName + "' in existing route '" + existing + "'")
+	}
+}
+
+// anyPattern returns the path pattern of a route registered at or below the
+// node, beginning with the path of the node.
+func (n *node) anyPattern() string {
+	path := n.path
+	for n.handle.len() == 0 {
+		switch {
+		case len(n.children) > 0:
+			n = n.children[0]
+		case n.catchAllChild != nil:
+			n = n.catchAllChild
+		default:
+			return path
+		}
+		path += n.path
+	}
+	return path
+}
+
+// insertRoute adds the route for the rest of the path fullPath below the node.
+func (n *node) insertRoute(method, path, fullPath string, route *Route) {
 	if len(n.path) == 0 && len(n.children) == 0 {
-		n.insertChild(method, path, handle)
+		n.insertChild(method, path, fullPath, route)
 		return
 	}
 
@@ -57,24 +274,35 @@ func (n *node) addRoute(method, path string, handle Handle) {
 
 		// Split edge
 		if i < len(n.path) {
-			n.children = []*node{&node{
-				path:      n.path[i:],
-				indices:   n.indices,
-				children:  n.children,
-				handle:    n.handle,
-				wildChild: n.wildChild,
-				priority:  n.priority,
-			}}
+			child := newNode(route)
+			*child = node{
+				path:          n.path[i:],
+				indices:       n.indices,
+				children:      n.children,
+				handle:        n.handle,
+				wildChild:     n.wildChild,
+				priority:      n.priority,
+				catchAllChild: n.catchAllChild,
+			}
+			n.children = []*node{child}
 			n.indices = []byte{n.path[i]}
 			n.path = path[:i]
-			n.handle = nil
+			n.handle = handles{}
 			n.wildChild = false
+			n.catchAllChild = nil
 		}
 
 		// Make new node a child of this node
 		if i < len(path) {
 			path = path[i:]
 
+			prefix := fullPath[:len(fullPath)-len(path)]
+
+			if path[0] == '*' {
+				n.addCatchAllChild(method, path, fullPath, route)
+				return
+			}
+
 			if n.wildChild {
 				n.priority++
 
@@ -82,67 +310,142 @@ func (n *node) addRoute(method, path string, handle Handle) {
 				// Check if the wildcard matches.
 				if len(path) >= len(n.path) && n.path == path[:len(n.path)] {
 					// Check for longer wildcard, e.g. :name and :namex
-					if len(n.path) >= len(path) || path[len(n.path)] == '/' {
-						n.addRoute(method, path, handle)
+					if len(n.path) >= len(path) || isParamEnd(path[len(n.path)], n.seps) ||
+						n.nType == param && path[len(n.path)] == '.' {
+						n.insertRoute(method, path, fullPath, route)
 						return
 					}
 				}
-				panic("conflict with wildcard route")
+				if n.nType == param && path[0] == ':' {
+					k := wildcardEnd(path, 0, n.seps)
+					if strings.TrimSuffix(path[:k], "+") == strings.TrimSuffix(n.path, "+") {
+						conflict("greedy and non-greedy param at the same position", fullPath, prefix+n.anyPattern())
+					}
+					nameMismatch(path[:k], n.path, fullPath, prefix+n.anyPattern())
+				}
+				conflict("conflict with wildcard route", fullPath, prefix+n.anyPattern())
 			}
 
 			c := path[0]
 
-			if n.nType == param && c == '/' && len(n.children) == 1 {
+			if n.isGreedy() && !greedyFollower(path) {
+				panic("greedy params must span whole path segments and be followed by a static segment in path '" +
+					fullPath + "'")
+			}
+
+			if n.nType == param && len(n.children) == 1 {
+				// The value of a param ends either at the end of the segment
+				// or at a literal within the segment, but not both. The
+				// existing child is the follower of all routes registered
+				// before, thus it conflicts in whichever order the routes are
+				// registered. Routes ending with the param itself don't
+				// conflict with either.
+				child := n.children[0]
+				if (len(child.path) == 0 || isParamEnd(child.path[0], n.seps)) != isParamEnd(c, n.seps) {
+					conflict("param is followed by a literal and by the end of the segment",
+						fullPath, prefix+child.anyPattern())
+				}
+
 				n.priority++
 				n = n.children[0]
-				n.addRoute(method, path, handle)
+				n.insertRoute(method, path, fullPath, route)
 				return
 			}
 
 			// Check if a child with the next path byte exists.
 			for i, index := range n.indices {
 				if c == index {
-					i = n.incrementChildPrio(i)
+					if !stablePriorities(route) {
+						i = n.incrementChildPrio(i)
+					}
 					n.priority++
 					n = n.children[i]
-					n.addRoute(method, path, handle)
+					n.insertRoute(method, path, fullPath, route)
 					return
 				}
 			}
 
 			// Otherwise insert it.
 			if c != ':' && c != '*' {
-				n.indices = append(n.indices, c)
-				child := &node{}
-				n.children = append(n.children, child)
-
-				n.incrementChildPrio(len(n.indices) - 1)
+				child := newNode(route)
+				if stablePriorities(route) {
+					n.insertIndex(c, child)
+				} else {
+					n.indices = append(n.indices, c)
+					n.children = append(n.children, child)
+					n.incrementChildPrio(len(n.indices) - 1)
+				}
 				n.priority++
 				n = child
 			}
 
-			n.insertChild(method, path, handle)
+			n.insertChild(method, path, fullPath, route)
 			return
 		} else if i == len(path) {
 			// Make node a (in-path) leaf.
-			if n.handle == nil {
-				n.handle = map[string]Handle{
-					method: handle,
-				}
-				n.priority++
-			} else {
-				if n.handle[method] != nil {
-					panic("a Handle is already registered for this method at this path")
-				}
-				n.handle[method] = handle
-				n.priority++
+			if n.isGreedy() {
+				panic("greedy params must span whole path segments and be followed by a static segment in path '" +
+					fullPath + "'")
 			}
+			if n.catchAllChild != nil {
+				conflict("conflict with wildcard route", fullPath, fullPath+n.catchAllChild.anyPattern())
+			}
+			n.addHandle(method, fullPath, route)
 		}
 		return
 	}
 }
 
-func (n *node) insertChild(method, path string, handle Handle) {
+// addHandle registers the route for the method at the node.
+func (n *node) addHandle(method, fullPath string, route *Route) {
+	if prev := n.handle.get(method); prev == nil {
+		n.handle.set(method, route)
+	} else if !prev.addCandidate(route) {
+		panic("a Handle is already registered for method " + method + " at path '" + fullPath + "'")
+	}
+	n.priority++
+}
+
+// addCatchAllChild registers the route for the catch-all wildcard path, which
+// follows the path of the node.
+// A catch-all can follow a parameter and static children, which take
+// precedence over it, but no handle of the node itself, since it matches the
+// path of the node as well.
+func (n *node) addCatchAllChild(method, path, fullPath string, route *Route) {
+	if len(n.path) == 0 || n.path[len(n.path)-1] != '/' {
+		panic("no / before catchAll in path '" + fullPath + "'")
+	}
+	if k := wildcardEnd(path, 0, ""); k == 1 {
+		panic("wildcards must be named with a non-empty name in path '" + fullPath + "'")
+	} else if k != len(path) {
+		panic("catchAlls are only allowed at the end of the path in path '" + fullPath + "'")
+	}
+
+	prefix := fullPath[:len(fullPath)-len(path)]
+	if child := n.catchAllChild; child != nil {
+		if child.path != path {
+			nameMismatch(path, child.path, fullPath, prefix+child.anyPattern())
+			conflict("conflict with wildcard route", fullPath, prefix+child.path)
+		}
+		child.addHandle(method, fullPath, route)
+		n.priority++
+		return
+	}
+
+	if n.handle.len() > 0 {
+		conflict("wildcard route conflicts with existing children", fullPath, prefix)
+	}
+	n.catchAllChild = newNode(route)
+	*n.catchAllChild = node{
+		path:     path,
+		handle:   handles{method: method, route: route},
+		nType:    catchAll,
+		priority: 1,
+	}
+	n.priority++
+}
+
+func (n *node) insertChild(method, path, fullPath string, route *Route) {
 	var offset int
 
 	// Find prefix until first wildcard (beginning with ':' or '*')
@@ -151,17 +454,16 @@ func (n *node) insertChild(method, path string, handle Handle) {
 			// Check if this node existing children which would be
 			// unreachable if we insert the wildcard here
 			if len(n.children) > 0 {
-				panic("wildcard route conflicts with existing children")
+				conflict("wildcard route conflicts with existing children",
+					fullPath, fullPath[:len(fullPath)-len(path)]+n.children[0].anyPattern())
 			}
 
 			// Find wildcard end (either '/' or path end)
-			k := i + 1
-			for k < j && path[k] != '/' {
-				k++
-			}
-
-			if k-i == 1 {
-				panic("wildcards must be named with a non-empty name")
+			seps := paramSeparators(route)
+			k := wildcardEnd(path, i, seps)
+			off := len(fullPath) - len(path)
+			if err := checkWildcard(fullPath, off+i, off+k); err != nil {
+				panic(err.Error() + " in path '" + fullPath + "'")
 			}
 
 			if b == ':' {
@@ -172,9 +474,9 @@ func (n *node) insertChild(method, path string, handle Handle) {
 					offset = i
 				}
 
-				child := &node{
-					nType: param,
-				}
+				child := newNode(route)
+				child.nType = param
+				child.seps = seps
 
 				n.children = []*node{child}
 				n.wildChild = true
@@ -183,83 +485,288 @@ func (n *node) insertChild(method, path string, handle Handle) {
 				n = child
 
 				// If the path doesn't end with the wildcard, then there will be
-				// another non-wildcard subpath starting with '/'
+				// another non-wildcard subpath starting with '/', a separator
+				// or a literal within the segment
 				if k < j {
 					n.path = path[offset:k]
 					offset = k
 
-					child := &node{}
+					child := newNode(route)
+					n.indices = []byte{path[k]}
 					n.children = []*node{child}
 					n.priority++
 
 					n = child
 				}
 			} else {
-				// CatchAll/
-				if len(path) != k {
-					panic("catchAlls are only allowed at the end of the path")
-				}
+				// CatchAll. The node holds the path up to and including the
+				// '/' before the wildcard.
+				n.path = path[offset:i]
+				n.addCatchAllChild(method, path[i:], fullPath, route)
+				return
+			}
+		}
+	}
 
-				// Currently fixed width 1 for '/'.
-				i--
-				if path[i] != '/' {
-					panic("no / before catchAll")
-				}
+	// Insert remaining path part and handle to the leaf.
+	n.path = path[offset:]
+	n.handle.set(method, route)
+	n.priority++
+}
 
-				n.path = path[offset:i]
+// WildcardType is the type of a wildcard in a path.
+type WildcardType uint8
 
-				// First node: catchAll node with empty path.
-				child := &node{
-					wildChild: true,
-					nType:     catchAll,
-				}
-				n.children = []*node{child}
-				n.indices = []byte{path[i]}
-				n.priority++
+const (
+	// Param is a named parameter, e.g. ":name".
+	Param WildcardType = iota + 1
 
-				n = child
+	// CatchAll is a catch-all wildcard, e.g. "*filepath".
+	CatchAll
 
-				// Second node: node holding the variable.
-				child = &node{
-					path: path[i:],
-					handle: map[string]Handle{
-						method: handle,
-					},
-					nType:    catchAll,
-					priority: 1,
-				}
-				n.children = []*node{child}
-				n.priority++
-				return
+	// GreedyParam is a parameter spanning path segments, e.g. ":path+".
+	GreedyParam
+)
+
+// Wildcard is a wildcard in a path.
+type Wildcard struct {
+	Name string
+	Type WildcardType
+}
+
+// ParseWildcards returns the wildcards of the given path in the order they
+// appear in it from left to right, without registering the path.
+// An error is returned if the path couldn't be registered because of an
+// invalid wildcard.
+func ParseWildcards(path string) ([]Wildcard, error) {
+	if len(path) == 0 || path[0] != '/' {
+		return nil, errors.New("path must begin with '/'")
+	}
+
+	var wildcards []Wildcard
+	for i := 0; i < len(path); i++ {
+		if b := path[i]; b == ':' || b == '*' {
+			k := wildcardEnd(path, i, "")
+			if err := checkWildcard(path, i, k); err != nil {
+				return nil, err
 			}
+
+			wildcard := Wildcard{Name: path[i+1 : k], Type: Param}
+			if b == '*' {
+				wildcard.Type = CatchAll
+			} else if strings.HasSuffix(wildcard.Name, "+") {
+				wildcard.Name = wildcard.Name[:len(wildcard.Name)-1]
+				wildcard.Type = GreedyParam
+			}
+			wildcards = append(wildcards, wildcard)
+			i = k
 		}
 	}
+	return wildcards, nil
+}
 
-	// Insert remaining path part and handle to the leaf.
-	n.path = path[offset:]
-	n.handle = map[string]Handle{
-		method: handle,
+// ExtractVars matches the path against the pattern like a Router with only a
+// route for the pattern matches request paths, and returns the values of the
+// wildcards, e.g. to check or explain paths offline. The bool reports whether
+// the path matches the pattern. It is false for invalid patterns as well.
+// Router options affecting matching, like ParamSeparators, don't apply.
+func ExtractVars(pattern, path string) (map[string]string, bool) {
+	if _, err := ParseWildcards(pattern); err != nil {
+		return nil, false
 	}
-	n.priority++
+
+	var n node
+	n.addRoute("GET", pattern, &Route{Method: "GET", Path: pattern})
+	route, vars, _ := n.getValue("GET", path)
+	if route == nil {
+		return nil, false
+	}
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+	return vars, true
 }
 
-// getValue returns the handle registered with the given path(path). The values of
+// wildcardEnd returns the end of the wildcard starting at path[i], which is
+// either the next '/' or the path end. The name of a param additionally ends
+// at the next '.' or one of the separators.
+func wildcardEnd(path string, i int, seps string) int {
+	k := i + 1
+	if path[i] == '*' {
+		for k < len(path) && path[k] != '/' {
+			k++
+		}
+		return k
+	}
+
+	for k < len(path) && !isParamEnd(path[k], seps) && path[k] != '.' {
+		k++
+	}
+	return k
+}
+
+// isNameChar reports whether c may be part of a wildcard name.
+func isNameChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_'
+}
+
+// checkWildcard checks whether the wildcard path[i:k] is valid.
+func checkWildcard(path string, i, k int) error {
+	name := path[i+1 : k]
+	greedy := path[i] == ':' && strings.HasSuffix(name, "+")
+	if greedy {
+		name = name[:len(name)-1]
+	}
+	if len(name) == 0 {
+		return errors.New("wildcards must be named with a non-empty name")
+	}
+
+	for _, c := range []byte(name) {
+		if !isNameChar(c) {
+			return fmt.Errorf("invalid character %q in the name of wildcard '%s', "+
+				"names may only contain letters, digits and '_'", c, path[i:k])
+		}
+	}
+
+	if path[i] == '*' {
+		if len(path) != k {
+			return errors.New("catchAlls are only allowed at the end of the path")
+		}
+		if i == 0 || path[i-1] != '/' {
+			return errors.New("no / before catchAll")
+		}
+	}
+	if greedy && (i == 0 || path[i-1] != '/' || !greedyFollower(path[k:])) {
+		return errors.New("greedy params must span whole path segments and be followed by a static segment")
+	}
+	return nil
+}
+
+// greedyFollower reports whether the rest of a path following a greedy param
+// begins with a static segment.
+func greedyFollower(rest string) bool {
+	return len(rest) >= 2 && rest[0] == '/' && rest[1] != '/' && rest[1] != ':' && rest[1] != '*'
+}
+
+// isGreedy reports whether the node is a greedy param, e.g. ":path+".
+func (n *node) isGreedy() bool {
+	return n.nType == param && n.path[len(n.path)-1] == '+'
+}
+
+// getValue returns the route registered with the given path(path). The values of
 // wildcards are saved to a map.
 // If no handle can be found, a TSR (trailing slash redirect) recommendation is
 // made if a handle exists with an extra (without the) trailing slash for the
 // given path.
-func (n *node) getValue(method, path string) (handle Handle, vars map[string]string, tsr bool) {
-	return n.getValueWithVars(method, path, nil)
+func (n *node) getValue(method, path string) (route *Route, vars map[string]string, tsr bool) {
+	route, vars, tsr, _ = n.match(method, path, matchOptions{})
+	return
 }
 
-func (n *node) getValueWithVars(method, path string, v map[string]string) (handle Handle, vars map[string]string, tsr bool) {
-	vars = v
-	// Walk the tree.
+// matchOptions are the options of a Router which affect matching.
+type matchOptions struct {
+	// The maximum length of a param value, or 0 for no limit.
+	maxParamLength int
+
+	// If not nil, the number of nodes visited by the walk is counted.
+	visited *int
+
+	// The offset in the path after which the catch-all is matched, even if
+	// another child of the node might match.
+	catchAllAt int
+
+	// Whether a catch-all matches the path without the trailing slash.
+	catchAllRoot CatchAllRootMode
+
+	// Whether a catch-all only matches values with a non-empty segment.
+	catchAllRequiresSegment bool
+
+	// Whether routes have explicit match priorities, thus all catch-alls
+	// passed are considered even if a route matched already.
+	priorities bool
+}
+
+// visit counts a visited node.
+func (o *matchOptions) visit() {
+	if o.visited != nil {
+		*o.visited++
+	}
+}
+
+// match is getValue with the given options.
+//
+// Children are matched in the order static, parameter, catch-all: if neither
+// a static child nor a parameter matches the rest of the path, the match
+// backtracks to the catch-alls passed, beginning with the deepest one. If
+// opts.priorities is set, a catch-all with a higher match priority than the
+// route matched is preferred.
+//
+// The returned fallback is the offset of the next catch-all passed, which is
+// matched with opts.catchAllAt set to it if the routes matched decline the
+// request, or 0 if there is none.
+func (n *node) match(method, path string, opts matchOptions) (route *Route, vars map[string]string, tsr bool, fallback int) {
+	route, vars, tsr, fallback = n.lookup(method, path, opts)
+	for fallback > 0 && (route == nil || opts.priorities) {
+		// Retry with the catch-alls passed, from the deepest one up. With
+		// explicit priorities, a catch-all only replaces the route matched
+		// so far if its priority is higher.
+		opts.catchAllAt = fallback
+		var fbRoute *Route
+		var fbVars map[string]string
+		fbRoute, fbVars, _, fallback = n.lookup(method, path, opts)
+		if fbRoute != nil && (route == nil || fbRoute.maxMatchPriority() > route.maxMatchPriority()) {
+			route, vars, tsr = fbRoute, fbVars, false
+			if !opts.priorities {
+				return
+			}
+		}
+	}
+	return
+}
+
+// lookup walks the tree to match the path. It returns the offset in the path
+// after the deepest catch-all passed as fallback.
+func (n *node) lookup(method, path string, opts matchOptions) (route *Route, vars map[string]string, tsr bool, fallback int) {
+	full := path
+
+	// Walk the tree. The walk is iterative, thus the stack usage doesn't grow
+	// with the depth of the path.
+	opts.visit()
+walk:
 	for len(path) >= len(n.path) && path[:len(n.path)] == n.path {
 		path = path[len(n.path):]
+		if n.catchAllChild != nil {
+			// Match the catch-all right away if it is the only child.
+			offset := len(full) - len(path)
+			if offset == opts.catchAllAt || !n.wildChild && len(n.indices) == 0 {
+				// The value includes the '/' before the catch-all.
+				value := full[offset-1:]
+				if opts.catchAllRequiresSegment && strings.Trim(value, "/") == "" &&
+					!n.catchAllChild.matchesEmpty(method) {
+					return nil, nil, tsr, fallback
+				}
+				n = n.catchAllChild
+				opts.visit()
+				if vars == nil {
+					vars = map[string]string{
+						n.path[1:]: value,
+					}
+				} else {
+					vars[n.path[1:]] = value
+				}
+
+				if route = n.handle.get(method); route != nil {
+					vars = route.applyDefaults(vars)
+				}
+				return
+			}
+			fallback = offset
+		}
+
 		if len(path) == 0 {
 			// Check if this node has a handle registered  for the given node.
-			if handle = n.handle[method]; handle != nil {
+			if route = n.handle.get(method); route != nil {
+				vars = route.applyDefaults(vars)
 				return
 			}
 
@@ -268,8 +775,14 @@ func (n *node) getValueWithVars(method, path string, v map[string]string) (handl
 			for i, index := range n.indices {
 				if index == '/' {
 					n = n.children[i]
-					tsr = n.path == "/" && n.handle != nil ||
-						n.nType == catchAll && n.children[0].handle[method] != nil
+					if n.path == "/" {
+						if route, vars = n.matchCatchAllRoot(method, vars, opts); route != nil {
+							return
+						}
+					}
+					tsr = n.path == "/" && (n.handle.len() > 0 ||
+						n.catchAllChild != nil && n.catchAllChild.handle.get(method) != nil &&
+							(!opts.catchAllRequiresSegment || n.catchAllChild.matchesEmpty(method)))
 					return
 				}
 			}
@@ -282,13 +795,53 @@ func (n *node) getValueWithVars(method, path string, v map[string]string) (handl
 
 		if n.wildChild {
 			n = n.children[0]
+			opts.visit()
 
 			switch n.nType {
 			case param:
-				// Find param end (either '/' or path end).
+				if n.isGreedy() {
+					route, vars = n.matchGreedy(method, path, vars, opts)
+					return route, vars, false, fallback
+				}
+
+				// If the param is followed by a literal within the segment,
+				// e.g. ".json" for ":id.json", the value ends at the first
+				// occurrence of the literal. The value must not be empty.
+				lit := ""
+				if len(n.children) > 0 {
+					if p := n.children[0].path; len(p) > 0 && !isParamEnd(p[0], n.seps) {
+						end := 1
+						for end < len(p) && !isParamEnd(p[end], n.seps) {
+							end++
+						}
+						lit = p[:end]
+					}
+				}
+
+				// Find param end (either '/', a separator or path end).
 				k := 0
-				for k < len(path) && path[k] != '/' {
+				for k < len(path) && !isParamEnd(path[k], n.seps) {
 					k++
+					if k == opts.maxParamLength && lit == "" {
+						// Abort the match if the value is too long.
+						if k < len(path) && !isParamEnd(path[k], n.seps) {
+							return nil, nil, false, fallback
+						}
+					}
+				}
+
+				if lit != "" {
+					if j := strings.Index(path[min(1, k):k], lit); j >= 0 {
+						k = j + 1
+					} else if k < len(path) {
+						// The segment doesn't contain the literal.
+						tsr = len(path) == k+1 && path[k] == '/' && n.handle.get(method) != nil
+						return
+					}
+					// The literal is not part of the value.
+					if opts.maxParamLength > 0 && k > opts.maxParamLength {
+						return nil, nil, false, fallback
+					}
 				}
 
 				// Save param value.
@@ -305,40 +858,28 @@ func (n *node) getValueWithVars(method, path string, v map[string]string) (handl
 					if len(n.children) > 0 {
 						path = path[k:]
 						n = n.children[0]
+						opts.visit()
 						continue
 					} else {
-						tsr = len(path) == k+1
+						tsr = len(path) == k+1 && path[k] == '/'
 						return
 					}
 				}
 
-				if handle = n.handle[method]; handle != nil {
+				if route = n.handle.get(method); route != nil {
+					vars = route.applyDefaults(vars)
 					return
 				} else if len(n.children) == 1 {
 					// No handle found. Check if a handle for this path + a
 					// trailing slash exists for TSR recommendation.
 					n = n.children[0]
-					tsr = n.path == "/" && n.handle[method] != nil
+					tsr = n.path == "/" && n.handle.get(method) != nil
 				}
 
 				// TODO: handle HTTP Error 405 - Method Not Allowed.
 				// Return available methods.
 
 				return
-			case catchAll:
-
-				// Catch all
-				// Save CatchAll value
-				if vars == nil {
-					vars = map[string]string{
-						n.path[2:]: path,
-					}
-				} else {
-					vars[n.path[2:]] = path
-				}
-
-				handle = n.handle[method]
-				return
 
 			default:
 				panic("unknown node type")
@@ -349,19 +890,291 @@ func (n *node) getValueWithVars(method, path string, v map[string]string) (handl
 
 		for i, index := range n.indices {
 			if c == index {
+				// Recommend a TSR if the child turns out to have no handle
+				// for the remaining trailing slash.
+				tsr = path == "/" && n.handle.get(method) != nil
 				n = n.children[i]
-				return n.getValueWithVars(method, path, vars)
+				opts.visit()
+				continue walk
 			}
 		}
 
 		// Nothing found. We can recommend to redirect to the save URL without
 		// a trailing slash if a leaf exists for that path.
-		tsr = path == "/" && n.handle[method] != nil
+		tsr = path == "/" && n.handle.get(method) != nil
 		return
 	}
 
 	// Nothing found. We can recommend to redirect to the same URL
-	// without trailing slash if a leaf exists for that path.
-	tsr = (len(path)+1 == len(n.path) && n.path[len(path)] == '/' && n.handle != nil) || (path == "/")
+	// with a trailing slash if a leaf exists for that path.
+	if len(path)+1 == len(n.path) && n.path[len(path)] == '/' && path == n.path[:len(path)] {
+		if route, vars = n.matchCatchAllRoot(method, vars, opts); route != nil {
+			return
+		}
+		tsr = n.handle.len() > 0 || n.catchAllChild != nil &&
+			(!opts.catchAllRequiresSegment || n.catchAllChild.matchesEmpty(method))
+		return
+	}
+	tsr = path == "/"
 	return
 }
+
+// matchGreedy matches the greedy param n and the subtree following it against
+// the path. The value of the param spans one or more path segments and ends
+// at an occurrence of the static path following the param. The occurrences
+// are tried from the first one on, until the rest of the path matches a route
+// of the subtree, e.g. /repos/:owner/:repo+/contents/*path matches
+// /repos/a/b/c/contents/x/y with repo="b/c" and path="/x/y".
+func (n *node) matchGreedy(method, path string, vars map[string]string, opts matchOptions) (*Route, map[string]string) {
+	child := n.children[0]
+	opts.catchAllAt = 0
+	for start := 1; start < len(path); {
+		j := strings.Index(path[start:], child.path)
+		if j < 0 {
+			break
+		}
+		j += start
+		if opts.maxParamLength > 0 && j > opts.maxParamLength {
+			break
+		}
+
+		if route, rest, _, _ := child.match(method, path[j:], opts); route != nil {
+			if vars == nil {
+				vars = make(map[string]string, len(rest)+1)
+			}
+			vars[n.path[1:len(n.path)-1]] = path[:j]
+			for name, value := range rest {
+				if _, ok := vars[name]; !ok {
+					vars[name] = value
+				}
+			}
+			return route, vars
+		}
+		start = j + 1
+	}
+	return nil, nil
+}
+
+// matchesEmpty reports whether the route of the catch-all node n for the
+// method matches an empty value regardless of CatchAllRequiresSegment.
+func (n *node) matchesEmpty(method string) bool {
+	route := n.handle.get(method)
+	return route != nil && route.matchesEmpty
+}
+
+// matchCatchAllRoot matches the catch-all following the node for the path of
+// the node without its trailing slash, if the mode of the options allows it.
+func (n *node) matchCatchAllRoot(method string, vars map[string]string, opts matchOptions) (*Route, map[string]string) {
+	if opts.catchAllRoot == CatchAllRootRedirect || opts.catchAllRequiresSegment || n.catchAllChild == nil {
+		return nil, vars
+	}
+	route := n.catchAllChild.handle.get(method)
+	if route == nil {
+		return nil, vars
+	}
+	opts.visit()
+
+	value := ""
+	if opts.catchAllRoot == CatchAllRootSlash {
+		value = "/"
+	}
+	if vars == nil {
+		vars = make(map[string]string, 1)
+	}
+	vars[n.catchAllChild.path[1:]] = value
+	return route, route.applyDefaults(vars)
+}
+
+// findPattern returns the node holding the routes registered for the path
+// pattern, or nil if there is no such node. Unlike getValue, wildcards in the
+// pattern only match wildcards of the same name.
+func (n *node) findPattern(pattern string) *node {
+walk:
+	for strings.HasPrefix(pattern, n.path) {
+		pattern = pattern[len(n.path):]
+		switch {
+		case len(pattern) == 0:
+			return n
+		case pattern[0] == '*':
+			if n.catchAllChild != nil && n.catchAllChild.path == pattern {
+				return n.catchAllChild
+			}
+			return nil
+		case n.wildChild || n.nType == param:
+			if len(n.children) == 0 {
+				return nil
+			}
+			n = n.children[0]
+			continue walk
+		}
+
+		for i, index := range n.indices {
+			if pattern[0] == index {
+				n = n.children[i]
+				continue walk
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// walk calls fn for the node and all nodes below it with the path pattern
+// leading to the node, which is the registered path for nodes with handles.
+func (n *node) walk(prefix string, fn func(path string, n *node)) {
+	prefix += n.path
+	fn(prefix, n)
+	for _, child := range n.children {
+		child.walk(prefix, fn)
+	}
+	if n.catchAllChild != nil {
+		n.catchAllChild.walk(prefix, fn)
+	}
+}
+
+// countRoutes walks the tree and returns the number of registered handles and
+// the maximum number of wildcards in the path of a handle.
+func (n *node) countRoutes() (routes, maxParams int) {
+	var walk func(n *node, params int)
+	walk = func(n *node, params int) {
+		if n.nType == param || n.nType == catchAll {
+			params++
+		}
+		if n.handle.len() > 0 {
+			routes += n.handle.len()
+			if params > maxParams {
+				maxParams = params
+			}
+		}
+		for _, child := range n.children {
+			walk(child, params)
+		}
+		if n.catchAllChild != nil {
+			walk(n.catchAllChild, params)
+		}
+	}
+	walk(n, 0)
+	return
+}
+
+// metrics returns the metrics of the subtree of the node.
+func (n *node) metrics() TreeMetrics {
+	var m TreeMetrics
+	var walk func(n *node, depth int)
+	walk = func(n *node, depth int) {
+		m.Nodes++
+		m.Handles += n.handle.len()
+		if depth > m.MaxDepth {
+			m.MaxDepth = depth
+		}
+		m.Bytes += n.size()
+		for _, child := range n.children {
+			walk(child, depth+1)
+		}
+		if n.catchAllChild != nil {
+			walk(n.catchAllChild, depth+1)
+		}
+	}
+	walk(n, 1)
+	return m
+}
+
+// size returns the approximate number of bytes used by the node itself,
+// including the memory its fields refer to, but not its children and the
+// registered routes.
+func (n *node) size() int {
+	size := int(unsafe.Sizeof(*n)) + len(n.path) + cap(n.indices) + len(n.seps) +
+		cap(n.children)*int(unsafe.Sizeof(n))
+	if n.handle.routes != nil {
+		// Approximate the map by its entries.
+		var method string
+		var route *Route
+		size += len(n.handle.routes) * int(unsafe.Sizeof(method)+unsafe.Sizeof(route))
+		for method := range n.handle.routes {
+			size += len(method)
+		}
+	}
+	return size
+}
+
+// dump writes the node and its children to w, one node per line, with the
+// priority, path, number of children, indices and the registered methods.
+func (n *node) dump(w io.Writer, prefix string) {
+	fmt.Fprintf(w, "%02d %s%s[%d](%s) %v\n", n.priority, prefix, n.path, len(n.children), n.indices, n.handle.methods())
+	prefix += strings.Repeat(" ", len(n.path))
+	for _, child := range n.children {
+		child.dump(w, prefix)
+	}
+	if n.catchAllChild != nil {
+		n.catchAllChild.dump(w, prefix)
+	}
+}
+
+// String returns the name of the node type.
+func (t nodeType) String() string {
+	switch t {
+	case static:
+		return "static"
+	case param:
+		return "param"
+	case catchAll:
+		return "catchAll"
+	}
+	return "unknown"
+}
+
+// jsonNode is the JSON representation of a node.
+type jsonNode struct {
+	Path     string      `json:"path"`
+	Indices  string      `json:"indices,omitempty"`
+	Type     string      `json:"nType"`
+	Methods  []string    `json:"methods,omitempty"`
+	Children []*jsonNode `json:"children,omitempty"`
+}
+
+// toJSON returns the JSON representation of the node and its children. The
+// catch-all child of a node is the last of its children.
+func (n *node) toJSON() *jsonNode {
+	jn := &jsonNode{
+		Path:    n.path,
+		Indices: string(n.indices),
+		Type:    n.nType.String(),
+		Methods: n.handle.methods(),
+	}
+	for _, child := range n.children {
+		jn.Children = append(jn.Children, child.toJSON())
+	}
+	if n.catchAllChild != nil {
+		jn.Children = append(jn.Children, n.catchAllChild.toJSON())
+	}
+	return jn
+}
+
+// Tree is the radix tree used by the Router to match paths, usable on its own,
+// e.g. to dispatch messages by topic. Like with the Router, a path can contain
+// parameters (:name) and catch-all wildcards (*name), and registering a
+// conflicting path panics.
+// The zero value is an empty tree ready to use.
+type Tree struct {
+	root node
+}
+
+// Add registers the handle for the method and path.
+func (t *Tree) Add(method, path string, h Handle) {
+	t.root.addRoute(method, path, &Route{
+		Method: method,
+		Path:   path,
+		Handle: h,
+	})
+}
+
+// Get returns the handle registered for the method and a path matching the
+// given path, together with the values of the wildcards.
+// The bool reports whether a handle was found.
+func (t *Tree) Get(method, path string) (Handle, map[string]string, bool) {
+	route, vars, _ := t.root.getValue(method, path)
+	if route == nil {
+		return nil, nil, false
+	}
+	return route.Handle, vars, true
+}
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -29,6 +31,10 @@ func fakeHandler(val string) Handle {
 	}
 }
 
+func fakeRoute(val string) *Route {
+	return &Route{Handle: fakeHandler(val)}
+}
+
 type testRequests []struct {
 	path       string
 	nilHandler bool
@@ -38,16 +44,16 @@ type testRequests []struct {
 
 func checkRequests(t *testing.T, tree *node, requests testRequests) {
 	for _, request := range requests {
-		handler, vars, _ := tree.getValue("GET", request.path)
+		route, vars, _ := tree.getValue("GET", request.path)
 
-		if handler == nil {
+		if route == nil {
 			if !request.nilHandler {
 				t.Errorf("handle mismatch for route '%s': expected non-nil handle", request.path)
 			}
 		} else if request.nilHandler {
 			t.Errorf("handle mismatch for route '%s': expected nil handle", request.route)
 		} else {
-			handler(nil, nil, nil)
+			route.Handle(nil, nil, nil)
 			if fakeHandlerValue != request.route {
 				t.Errorf("handle mismatch for route '%s': wrong handle (%s != %s)", request.route, fakeHandlerValue, request.route)
 			}
@@ -66,7 +72,11 @@ func checkPriorities(t *testing.T, n *node) uint32 {
 		prio += checkPriorities(t, n.children[i])
 	}
 
-	prio += uint32(len(n.handle))
+	if n.catchAllChild != nil {
+		prio += checkPriorities(t, n.catchAllChild)
+	}
+
+	prio += uint32(n.handle.len())
 
 	if n.priority != prio {
 		t.Errorf("priority mismatch for node '%s': is %d, should be %d",
@@ -94,7 +104,7 @@ func TestTreeAddAndGet(t *testing.T) {
 	}
 
 	for _, route := range routes {
-		tree.addRoute("GET", route, fakeHandler(route))
+		tree.addRoute("GET", route, fakeRoute(route))
 	}
 
 	//printChildren(tree, "")
@@ -134,7 +144,7 @@ func TestTreeWildcard(t *testing.T) {
 	}
 
 	for _, route := range routes {
-		tree.addRoute("GET", route, fakeHandler(route))
+		tree.addRoute("GET", route, fakeRoute(route))
 	}
 
 	//printChildren(tree, "")
@@ -166,6 +176,13 @@ func catchPanic(testFunc func()) (recv interface{}) {
 	return
 }
 
+// reversed returns a copy of the routes in reverse order.
+func reversed(routes []string) []string {
+	r := slices.Clone(routes)
+	slices.Reverse(r)
+	return r
+}
+
 type testRoute struct {
 	path     string
 	conflict bool
@@ -176,7 +193,7 @@ func testRoutes(t *testing.T, routes []testRoute) {
 
 	for _, route := range routes {
 		recv := catchPanic(func() {
-			tree.addRoute("GET", route.path, nil)
+			tree.addRoute("GET", route.path, fakeRoute(route.path))
 		})
 
 		if route.conflict {
@@ -216,13 +233,13 @@ func TestTreeChildConflict(t *testing.T) {
 		{"/cmd/vet", false},
 		{"/cmd/:tool/:sub", true},
 		{"/src/AUTHOR", false},
-		{"/src/*filepath", true},
+		{"/src/*filepath", false},
 		{"/user_x", false},
 		{"/user_:name", true},
 		{"/id/:id", false},
 		{"/id:id", true},
 		{"/:id", true},
-		{"/*filepath", true},
+		{"/*filepath", false},
 	}
 
 	testRoutes(t, routes)
@@ -241,7 +258,7 @@ func TestTreeDuplicatePath(t *testing.T) {
 
 	for _, route := range routes {
 		recv := catchPanic(func() {
-			tree.addRoute("GET", route, fakeHandler(route))
+			tree.addRoute("GET", route, fakeRoute(route))
 		})
 
 		if recv != nil {
@@ -278,7 +295,7 @@ func TestTreeEmptyWildcardName(t *testing.T) {
 
 	for _, route := range routes {
 		recv := catchPanic(func() {
-			tree.addRoute("GET", route, fakeHandler(route))
+			tree.addRoute("GET", route, fakeRoute(route))
 		})
 
 		if recv == nil {
@@ -321,11 +338,13 @@ func TestTreeTrailingSlashRedirect(t *testing.T) {
 		"/doc/go1.html",
 		"/no/a",
 		"/no/b",
+		"/p",
+		"/p/:id",
 	}
 
 	for _, route := range routes {
 		recv := catchPanic(func() {
-			tree.addRoute("GET", route, fakeHandler(route))
+			tree.addRoute("GET", route, fakeRoute(route))
 		})
 
 		if recv != nil {
@@ -345,11 +364,12 @@ func TestTreeTrailingSlashRedirect(t *testing.T) {
 		"/1/go",
 		"/a",
 		"/doc/",
+		"/p/",
 	}
 
 	for _, route := range tsrRoutes {
-		handler, _, tsr := tree.getValue("GET", route)
-		if handler != nil {
+		r, _, tsr := tree.getValue("GET", route)
+		if r != nil {
 			t.Fatalf("non-nil handle for TSR route '%s'", route)
 		} else if !tsr {
 			t.Errorf("expected TSR recommendation for route '%s'", route)
@@ -365,11 +385,609 @@ func TestTreeTrailingSlashRedirect(t *testing.T) {
 	}
 
 	for _, route := range noTsrRoutes {
-		handler, _, tsr := tree.getValue("GET", route)
-		if handler != nil {
+		r, _, tsr := tree.getValue("GET", route)
+		if r != nil {
 			t.Errorf("non-nil handle for no-TSR route '%s'", route)
 		} else if tsr {
 			t.Errorf("expected no TSR recommendation for route '%s'", route)
 		}
 	}
+
+	// The path must equal the node path without its trailing slash.
+	tree = &node{}
+	tree.addRoute("GET", "/abc/", fakeRoute("/abc/"))
+	if _, _, tsr := tree.getValue("GET", "/xyz"); tsr {
+		t.Error("expected no TSR recommendation for route '/xyz'")
+	}
+	if _, _, tsr := tree.getValue("GET", "/abc"); !tsr {
+		t.Error("expected TSR recommendation for route '/abc'")
+	}
+}
+
+func TestTreeDeepPath(t *testing.T) {
+	tree := &node{}
+
+	var static, wild, req string
+	for i := 0; i < 64; i++ {
+		static += fmt.Sprintf("/s%d", i)
+		if i%2 == 0 {
+			wild += fmt.Sprintf("/w%d", i)
+			req += fmt.Sprintf("/w%d", i)
+		} else {
+			wild += fmt.Sprintf("/:p%d", i)
+			req += fmt.Sprintf("/v%d", i)
+		}
+	}
+
+	tree.addRoute("GET", static, fakeRoute(static))
+	tree.addRoute("GET", static+"/", fakeRoute(static+"/"))
+	tree.addRoute("GET", wild, fakeRoute(wild))
+
+	vars := map[string]string{}
+	for i := 1; i < 64; i += 2 {
+		vars[fmt.Sprintf("p%d", i)] = fmt.Sprintf("v%d", i)
+	}
+
+	checkRequests(t, tree, testRequests{
+		{static, false, static, nil},
+		{static + "/", false, static + "/", nil},
+		{static + "/x", true, "", nil},
+		{req, false, wild, vars},
+	})
+
+	if _, _, tsr := tree.getValue("GET", req+"/"); !tsr {
+		t.Errorf("expected TSR recommendation for deep route '%s/'", req)
+	}
+
+	checkPriorities(t, tree)
+}
+
+func TestParseWildcards(t *testing.T) {
+	tests := []struct {
+		path      string
+		wildcards []Wildcard
+		err       bool
+	}{
+		{"/", nil, false},
+		{"/doc/go1.html", nil, false},
+		{"/user/:name", []Wildcard{{"name", Param}}, false},
+		{"/user_:name/about", []Wildcard{{"name", Param}}, false},
+		{"/cmd/:tool/:sub", []Wildcard{{"tool", Param}, {"sub", Param}}, false},
+		{"/src/*filepath", []Wildcard{{"filepath", CatchAll}}, false},
+		{"/files/:dir/*filepath", []Wildcard{{"dir", Param}, {"filepath", CatchAll}}, false},
+		{"/:a/x/:b/*c", []Wildcard{{"a", Param}, {"b", Param}, {"c", CatchAll}}, false},
+		{"", nil, true},
+		{"noSlashRoot", nil, true},
+		{"/user:", nil, true},
+		{"/cmd/:/", nil, true},
+		{"/src/*", nil, true},
+		{"/src/*filepath/x", nil, true},
+		{"/src*filepath", nil, true},
+		{"/user/:user_id2", []Wildcard{{"user_id2", Param}}, false},
+		{"/user/:name.json", []Wildcard{{"name", Param}}, false},
+		{"/user/:user-id", nil, true},
+		{"/user/:a:b", nil, true},
+		{"/user/:n\u00e4me", nil, true},
+		{"/src/*file.path", nil, true},
+		{"/src/*file-path", nil, true},
+		{"/repos/:repo+/contents", []Wildcard{{"repo", GreedyParam}}, false},
+		{"/repos/:repo+", nil, true},
+		{"/repos/:repo+/", nil, true},
+		{"/repos/:repo+/:x", nil, true},
+		{"/repos/:+/contents", nil, true},
+		{"/repos/x:repo+/contents", nil, true},
+	}
+
+	for _, test := range tests {
+		wildcards, err := ParseWildcards(test.path)
+		if test.err {
+			if err == nil {
+				t.Errorf("no error for invalid path '%s'", test.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error for path '%s': %v", test.path, err)
+		}
+		if !reflect.DeepEqual(wildcards, test.wildcards) {
+			t.Errorf("wrong wildcards for path '%s': want %v, got %v", test.path, test.wildcards, wildcards)
+		}
+
+		recv := catchPanic(func() {
+			tree := &node{}
+			tree.addRoute("GET", test.path, fakeRoute(test.path))
+		})
+		if recv != nil {
+			t.Errorf("panic inserting valid path '%s': %v", test.path, recv)
+		}
+	}
+}
+
+func TestExtractVars(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		vars    map[string]string
+		ok      bool
+	}{
+		{"/", "/", map[string]string{}, true},
+		{"/doc/go1.html", "/doc/go1.html", map[string]string{}, true},
+		{"/doc/go1.html", "/doc/go2.html", nil, false},
+		{"/user/:name", "/user/gopher", map[string]string{"name": "gopher"}, true},
+		{"/user/:name", "/user/gopher/", nil, false},
+		{"/user/:name", "/user/", nil, false},
+		{"/user_:name/about", "/user_gopher/about", map[string]string{"name": "gopher"}, true},
+		{"/cmd/:tool/:sub", "/cmd/vet/shadow", map[string]string{"tool": "vet", "sub": "shadow"}, true},
+		{"/files/:dir/*filepath", "/files/js/a/b.js", map[string]string{"dir": "js", "filepath": "/a/b.js"}, true},
+		{"/files/:dir/*filepath", "/files/js", nil, false},
+		{"/user/:name.json", "/user/gopher.json", map[string]string{"name": "gopher"}, true},
+		{"/repos/:repo+/contents", "/repos/a/b/contents", map[string]string{"repo": "a/b"}, true},
+		{"/src/*", "/src/x", nil, false},
+		{"noslash", "noslash", nil, false},
+	}
+	for _, test := range tests {
+		vars, ok := ExtractVars(test.pattern, test.path)
+		if ok != test.ok || !reflect.DeepEqual(vars, test.vars) {
+			t.Errorf("ExtractVars(%q, %q) = %v, %t, want %v, %t",
+				test.pattern, test.path, vars, ok, test.vars, test.ok)
+		}
+	}
+}
+
+func TestTreeParamLiteral(t *testing.T) {
+	routes := []string{
+		"/files/:name",
+		"/files/:name.:ext",
+		"/report-:id.json",
+		"/report-:id.json/meta",
+		"/v:version/users",
+		"/img/:w.:h/:file.png",
+	}
+
+	// The routes match alike in whichever order they are registered.
+	for _, routes := range [][]string{routes, reversed(routes)} {
+		tree := &node{}
+		for _, route := range routes {
+			recv := catchPanic(func() {
+				tree.addRoute("GET", route, fakeRoute(route))
+			})
+			if recv != nil {
+				t.Fatalf("panic inserting route '%s': %v", route, recv)
+			}
+		}
+
+		checkRequests(t, tree, testRequests{
+			{"/files/readme", false, "/files/:name", map[string]string{"name": "readme"}},
+			{"/files/report.pdf", false, "/files/:name.:ext", map[string]string{"name": "report", "ext": "pdf"}},
+			{"/files/a.b.c", false, "/files/:name.:ext", map[string]string{"name": "a", "ext": "b.c"}},
+			{"/files/.hidden", false, "/files/:name", map[string]string{"name": ".hidden"}},
+			{"/files/readme/x", true, "", nil},
+			{"/report-42.json", false, "/report-:id.json", map[string]string{"id": "42"}},
+			{"/report-4.2.json", false, "/report-:id.json", map[string]string{"id": "4.2"}},
+			{"/report-42.json/meta", false, "/report-:id.json/meta", map[string]string{"id": "42"}},
+			{"/report-42.xml", true, "", map[string]string{"id": "42.xml"}},
+			{"/report-.json", true, "", map[string]string{"id": ".json"}},
+			{"/v2.3/users", false, "/v:version/users", map[string]string{"version": "2.3"}},
+			{"/img/640.480/cat.png", false, "/img/:w.:h/:file.png", map[string]string{"w": "640", "h": "480", "file": "cat"}},
+		})
+
+		if route, _, tsr := tree.getValue("GET", "/files/readme/"); route != nil || !tsr {
+			t.Error("expected TSR recommendation for '/files/readme/'")
+		}
+		if route, _, tsr := tree.getValue("GET", "/report-42/"); route != nil || tsr {
+			t.Error("expected no TSR recommendation for '/report-42/'")
+		}
+
+		checkPriorities(t, tree)
+	}
+
+	testRoutes(t, []testRoute{
+		{"/files/:name.:ext", false},
+		{"/files/:name/meta", true},
+		{"/files/:name.json", true},
+		{"/files/:namex", true},
+		{"/dir/:name/meta", false},
+		{"/dir/:name.json", true},
+	})
+}
+
+func TestTreeAPI(t *testing.T) {
+	var tree Tree
+
+	var got string
+	handleFor := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ map[string]string) {
+			got = name
+		}
+	}
+	tree.Add("PUBLISH", "/orders/:id/created", handleFor("created"))
+	tree.Add("PUBLISH", "/orders/:id/shipped", handleFor("shipped"))
+	tree.Add("SUBSCRIBE", "/orders/:id/created", handleFor("subscribe"))
+	tree.Add("PUBLISH", "/logs/*stream", handleFor("logs"))
+
+	tests := []struct {
+		method string
+		path   string
+		found  bool
+		name   string
+		vars   map[string]string
+	}{
+		{"PUBLISH", "/orders/42/created", true, "created", map[string]string{"id": "42"}},
+		{"PUBLISH", "/orders/42/shipped", true, "shipped", map[string]string{"id": "42"}},
+		{"SUBSCRIBE", "/orders/7/created", true, "subscribe", map[string]string{"id": "7"}},
+		{"PUBLISH", "/logs/app/errors", true, "logs", map[string]string{"stream": "/app/errors"}},
+		{"SUBSCRIBE", "/orders/7/shipped", false, "", nil},
+		{"PUBLISH", "/orders/42", false, "", nil},
+		{"PUBLISH", "/payments", false, "", nil},
+	}
+
+	for _, test := range tests {
+		h, vars, found := tree.Get(test.method, test.path)
+		if found != test.found {
+			t.Errorf("%s %s: want found=%t, got %t", test.method, test.path, test.found, found)
+			continue
+		}
+		if !found {
+			if h != nil || vars != nil {
+				t.Errorf("%s %s: expected no handle and vars, got %v", test.method, test.path, vars)
+			}
+			continue
+		}
+		got = ""
+		h(nil, nil, vars)
+		if got != test.name {
+			t.Errorf("%s %s: wrong handle, want %s, got %s", test.method, test.path, test.name, got)
+		}
+		if !reflect.DeepEqual(vars, test.vars) {
+			t.Errorf("%s %s: wrong vars, want %v, got %v", test.method, test.path, test.vars, vars)
+		}
+	}
+
+	recv := catchPanic(func() {
+		tree.Add("PUBLISH", "/orders/:order/created", handleFor("conflict"))
+	})
+	if recv == nil {
+		t.Errorf("no panic while adding a conflicting path")
+	}
+}
+
+func TestNodeHandles(t *testing.T) {
+	var h handles
+	get, post := fakeRoute("GET"), fakeRoute("POST")
+
+	h.set("GET", get)
+	if h.routes != nil || h.len() != 1 || h.get("GET") != get || h.get("POST") != nil {
+		t.Fatalf("wrong handles after registering a single method: %+v", h)
+	}
+
+	h.set("POST", post)
+	if h.routes == nil || h.len() != 2 || h.get("GET") != get || h.get("POST") != post {
+		t.Fatalf("wrong handles after registering a second method: %+v", h)
+	}
+	if h.get("") != nil {
+		t.Errorf("unexpected route for empty method")
+	}
+}
+
+// singleMethodRoutes returns n paths, each registered for a single method.
+func singleMethodRoutes(n int) []string {
+	paths := make([]string, n)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("/resource%d/:id/items", i)
+	}
+	return paths
+}
+
+func BenchmarkTreeSingleMethodRoutes(b *testing.B) {
+	paths := singleMethodRoutes(1000)
+	route := fakeRoute("")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tree := &node{}
+		for _, path := range paths {
+			tree.addRoute("GET", path, route)
+		}
+	}
+}
+
+func TestTreeParamSuffix(t *testing.T) {
+	routes := []string{
+		"/report-:id.json",
+		"/report-:id.xml",
+		"/report-:id.tar.gz",
+		"/report-:id",
+		"/export/:id.csv",
+	}
+
+	for _, routes := range [][]string{routes, reversed(routes)} {
+		tree := &node{}
+		for _, route := range routes {
+			recv := catchPanic(func() {
+				tree.addRoute("GET", route, fakeRoute(route))
+			})
+			if recv != nil {
+				t.Fatalf("panic inserting route '%s': %v", route, recv)
+			}
+		}
+
+		checkRequests(t, tree, testRequests{
+			{"/report-42.json", false, "/report-:id.json", map[string]string{"id": "42"}},
+			{"/report-42.xml", false, "/report-:id.xml", map[string]string{"id": "42"}},
+			{"/report-42.tar.gz", false, "/report-:id.tar.gz", map[string]string{"id": "42"}},
+			{"/report-42.yaml", true, "", map[string]string{"id": "42"}},
+			{"/report-42", false, "/report-:id", map[string]string{"id": "42"}},
+			{"/export/7.csv", false, "/export/:id.csv", map[string]string{"id": "7"}},
+			{"/export/7.csv/", true, "", map[string]string{"id": "7"}},
+			{"/export/7", true, "", map[string]string{"id": "7"}},
+		})
+
+		if route, _, tsr := tree.getValue("GET", "/export/7.csv/"); route != nil || !tsr {
+			t.Error("expected TSR recommendation for '/export/7.csv/'")
+		}
+
+		checkPriorities(t, tree)
+	}
+
+	testRoutes(t, []testRoute{
+		{"/report-:id.json", false},
+		{"/report-:name.json", true},
+		{"/report-:id", false},
+		{"/report-:id/meta", true},
+		{"/report-latest.json", true},
+		{"/export/:id.csv/meta", false},
+		{"/suffix/:id-v1", true},
+	})
+	testRoutes(t, []testRoute{
+		{"/report-:id/meta", false},
+		{"/report-:id", false},
+		{"/report-:id.json", true},
+		{"/report-latest.json", true},
+	})
+}
+
+func TestTreeParamFollowerOrder(t *testing.T) {
+	// A param is followed either by a literal within its segment or by the
+	// end of the segment, whichever route is registered first.
+	tests := []struct {
+		a, b     string
+		conflict bool
+	}{
+		{"/a/:id.json", "/a/:id", false},
+		{"/a/:id/x", "/a/:id", false},
+		{"/a/:id.json", "/a/:id.xml", false},
+		{"/a/:id.v1", "/a/:id.json", false},
+		{"/a/:id.json", "/a/:id/x", true},
+		{"/a/:id.json", "/a/:id/", true},
+		{"/a/:id.:ext", "/a/:id/*rest", true},
+		{"/a/:id.v1", "/a/:id/:tab", true},
+	}
+	for _, test := range tests {
+		for _, routes := range [][]string{{test.a, test.b}, {test.b, test.a}} {
+			tree := &node{}
+			tree.addRoute("GET", routes[0], fakeRoute(routes[0]))
+			recv := catchPanic(func() {
+				tree.addRoute("GET", routes[1], fakeRoute(routes[1]))
+			})
+			if conflict := recv != nil; conflict != test.conflict {
+				t.Errorf("inserting '%s' after '%s': want conflict=%t, got %v",
+					routes[1], routes[0], test.conflict, recv)
+			}
+		}
+	}
+}
+
+func TestTreeParamAndCatchAll(t *testing.T) {
+	for _, routes := range [][]string{
+		{"/files/:name", "/files/:name/meta", "/files/*path", "/u/:id/:tab", "/u/:id/*rest"},
+		{"/files/*path", "/files/:name", "/files/:name/meta", "/u/:id/*rest", "/u/:id/:tab"},
+	} {
+		tree := &node{}
+		for _, route := range routes {
+			recv := catchPanic(func() {
+				tree.addRoute("GET", route, fakeRoute(route))
+			})
+			if recv != nil {
+				t.Fatalf("panic inserting route '%s': %v", route, recv)
+			}
+		}
+
+		checkRequests(t, tree, testRequests{
+			{"/files/readme", false, "/files/:name", map[string]string{"name": "readme"}},
+			{"/files/readme/meta", false, "/files/:name/meta", map[string]string{"name": "readme"}},
+			{"/files/a/b", false, "/files/*path", map[string]string{"path": "/a/b"}},
+			{"/files/readme/", false, "/files/*path", map[string]string{"path": "/readme/"}},
+			{"/files/", false, "/files/*path", map[string]string{"path": "/"}},
+			{"/u/1/posts", false, "/u/:id/:tab", map[string]string{"id": "1", "tab": "posts"}},
+			{"/u/1/posts/2", false, "/u/:id/*rest", map[string]string{"id": "1", "rest": "/posts/2"}},
+		})
+
+		checkPriorities(t, tree)
+	}
+
+	testRoutes(t, []testRoute{
+		{"/files/:name", false},
+		{"/files/*path", false},
+		{"/files/*other", true},
+		{"/files/static", true},
+		{"/files/", true},
+		{"/dir/*path", false},
+		{"/dir/:name", false},
+		{"/dir/static", true},
+	})
+}
+
+func TestTreeConflictMessage(t *testing.T) {
+	tests := []struct {
+		existing, path string
+	}{
+		{"/user/:name", "/user/:id"},
+		{"/user/:name/profile", "/user/new"},
+		{"/src/*filepath", "/src/"},
+		{"/src/*filepath", "/src/*path"},
+		{"/files/", "/files/*path"},
+		{"/report-:id.json", "/report-:id/raw"},
+		{"/cmd/:tool", "/cmd/:tool"},
+	}
+	for _, test := range tests {
+		tree := &node{}
+		tree.addRoute("GET", test.existing, fakeRoute(test.existing))
+		recv := catchPanic(func() {
+			tree.addRoute("GET", test.path, fakeRoute(test.path))
+		})
+		msg, _ := recv.(string)
+		if msg == "" {
+			t.Errorf("no panic inserting '%s' after '%s'", test.path, test.existing)
+			continue
+		}
+		if !strings.Contains(msg, "'"+test.path+"'") || !strings.Contains(msg, test.existing) {
+			t.Errorf("panic message %q does not name '%s' and '%s'", msg, test.path, test.existing)
+		}
+	}
+}
+
+func TestTreeWildcardNameMismatch(t *testing.T) {
+	tests := []struct {
+		existing, path string
+		mismatch       bool
+	}{
+		{"/user/:id/posts", "/user/:id/comments", false},
+		{"/user/:id/posts", "/user/:uid/comments", true},
+		{"/user/:id/posts", "/user/:idx/comments", true},
+		{"/report-:id.json", "/report-:name.xml", true},
+		{"/src/*filepath", "/src/*filepath", false},
+		{"/src/*filepath", "/src/*path", true},
+	}
+	for _, test := range tests {
+		tree := &node{}
+		tree.addRoute("GET", test.existing, fakeRoute(test.existing))
+		recv := catchPanic(func() {
+			tree.addRoute("POST", test.path, fakeRoute(test.path))
+		})
+		msg, _ := recv.(string)
+		if mismatch := strings.Contains(msg, "must have the same name"); mismatch != test.mismatch {
+			t.Errorf("inserting '%s' after '%s': want mismatch=%t, got %v", test.path, test.existing, test.mismatch, recv)
+		}
+		if test.mismatch && !strings.Contains(msg, test.existing) {
+			t.Errorf("panic message %q does not name the existing route '%s'", msg, test.existing)
+		}
+		if !test.mismatch && recv != nil {
+			t.Errorf("unexpected panic inserting '%s' after '%s': %v", test.path, test.existing, recv)
+		}
+	}
+}
+
+func TestTreeWildcardNames(t *testing.T) {
+	testRoutes(t, []testRoute{
+		{"/user/:User_ID9", false},
+		{"/user/:User_ID9.json/x", false},
+		{"/item/:item-id", true},
+		{"/item/:item id", true},
+		{"/item/:a:b", true},
+		{"/src/*file.path", true},
+		{"/src/*file~path", true},
+	})
+}
+
+func TestTreeStaticAndCatchAll(t *testing.T) {
+	for _, routes := range [][]string{
+		{"/health", "/metrics", "/*filepath", "/api/:id/posts", "/api/:id/*rest", "/static/*file", "/static/logo.png"},
+		{"/*filepath", "/static/logo.png", "/api/:id/*rest", "/static/*file", "/api/:id/posts", "/metrics", "/health"},
+	} {
+		tree := &node{}
+		for _, route := range routes {
+			recv := catchPanic(func() {
+				tree.addRoute("GET", route, fakeRoute(route))
+			})
+			if recv != nil {
+				t.Fatalf("panic inserting route '%s': %v", route, recv)
+			}
+		}
+
+		checkRequests(t, tree, testRequests{
+			{"/health", false, "/health", nil},
+			{"/metrics", false, "/metrics", nil},
+			{"/", false, "/*filepath", map[string]string{"filepath": "/"}},
+			{"/index.html", false, "/*filepath", map[string]string{"filepath": "/index.html"}},
+			{"/healthz", false, "/*filepath", map[string]string{"filepath": "/healthz"}},
+			{"/health/", false, "/*filepath", map[string]string{"filepath": "/health/"}},
+			{"/heal", false, "/*filepath", map[string]string{"filepath": "/heal"}},
+			{"/api/1/posts", false, "/api/:id/posts", map[string]string{"id": "1"}},
+			{"/api/1/posts/2", false, "/api/:id/*rest", map[string]string{"id": "1", "rest": "/posts/2"}},
+			{"/api", false, "/*filepath", map[string]string{"filepath": "/api"}},
+			{"/static/logo.png", false, "/static/logo.png", nil},
+			{"/static/app.js", false, "/static/*file", map[string]string{"file": "/app.js"}},
+		})
+
+		checkPriorities(t, tree)
+	}
+
+	// A catch-all without a handle for the method falls back to the next
+	// catch-all above it.
+	tree := &node{}
+	tree.addRoute("GET", "/*filepath", fakeRoute("/*filepath"))
+	tree.addRoute("GET", "/health", fakeRoute("/health"))
+	tree.addRoute("POST", "/upload/*file", fakeRoute("/upload/*file"))
+	tree.addRoute("GET", "/upload/form", fakeRoute("/upload/form"))
+	checkRequests(t, tree, testRequests{
+		{"/upload/a", false, "/*filepath", map[string]string{"filepath": "/upload/a"}},
+		{"/upload/form", false, "/upload/form", nil},
+	})
+}
+
+func TestTreeGreedyParam(t *testing.T) {
+	tree := &node{}
+	routes := [...]string{
+		"/repos/:owner/:repo+/contents/*path",
+		"/repos/:owner/:repo+/commits",
+		"/repos/:owner/:repo+/commits/:sha",
+		"/repos/:owner",
+		"/g/:a+/x/:b+/y",
+	}
+	for _, route := range routes {
+		tree.addRoute("GET", route, fakeRoute(route))
+	}
+
+	checkRequests(t, tree, testRequests{
+		{"/repos/a/b/contents/x", false, "/repos/:owner/:repo+/contents/*path", map[string]string{"owner": "a", "repo": "b", "path": "/x"}},
+		{"/repos/a/b/c/contents/x/y", false, "/repos/:owner/:repo+/contents/*path", map[string]string{"owner": "a", "repo": "b/c", "path": "/x/y"}},
+		{"/repos/a/b/contents/c/contents/x", false, "/repos/:owner/:repo+/contents/*path", map[string]string{"owner": "a", "repo": "b", "path": "/c/contents/x"}},
+		{"/repos/a/b/c/commits", false, "/repos/:owner/:repo+/commits", map[string]string{"owner": "a", "repo": "b/c"}},
+		{"/repos/a/b/c/commits/123", false, "/repos/:owner/:repo+/commits/:sha", map[string]string{"owner": "a", "repo": "b/c", "sha": "123"}},
+		// The first occurrence of /commits doesn't match, the value backtracks
+		// to the next one.
+		{"/repos/a/commits/x/commits", false, "/repos/:owner/:repo+/commits", map[string]string{"owner": "a", "repo": "commits/x"}},
+		{"/repos/a", false, "/repos/:owner", map[string]string{"owner": "a"}},
+		{"/repos/a/contents/x", true, "", nil},
+		{"/repos/a/b/c", true, "", nil},
+		{"/repos/a/b/commitsx", true, "", nil},
+		{"/g/1/2/x/3/4/y", false, "/g/:a+/x/:b+/y", map[string]string{"a": "1/2", "b": "3/4"}},
+		{"/g/1/x/x/2/y", false, "/g/:a+/x/:b+/y", map[string]string{"a": "1", "b": "x/2"}},
+	})
+
+	checkPriorities(t, tree)
+}
+
+func TestTreeGreedyParamConflict(t *testing.T) {
+	tests := []struct {
+		existing, path string
+	}{
+		{"/repos/:repo+/contents", "/repos/:repo/contents"},
+		{"/repos/:repo/contents", "/repos/:repo+/contents"},
+		{"/repos/:repo+/contents", "/repos/:repo+"},
+		{"/repos/:repo+/contents", "/repos/:repo+/"},
+		{"/repos/:repo+/contents", "/repos/:repo+/:x"},
+		{"/repos/:repo+/contents", "/repos/:name+/contents"},
+		{"/repos/:repo+/contents", "/repos/static"},
+	}
+	for _, test := range tests {
+		tree := &node{}
+		tree.addRoute("GET", test.existing, fakeRoute(test.existing))
+		recv := catchPanic(func() {
+			tree.addRoute("GET", test.path, fakeRoute(test.path))
+		})
+		if recv == nil {
+			t.Errorf("no panic inserting '%s' after '%s'", test.path, test.existing)
+		}
+	}
 }